@@ -0,0 +1,211 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// QueueFullPolicy determines how a WriteCloser configured by WithAsync behaves
+// when it flushes lines while its queue is full.
+type QueueFullPolicy int
+
+const (
+	// BlockWhenFull causes the flush to block until the background goroutine
+	// removes a chunk of lines from the queue.
+	BlockWhenFull QueueFullPolicy = iota
+
+	// DropNewest discards the chunk of lines being flushed.
+	DropNewest
+
+	// DropOldest discards the oldest chunk of lines in the queue to make room
+	// for the chunk being flushed.
+	DropOldest
+)
+
+// ErrDrainTimeout is returned by Close when the queue of a WriteCloser
+// configured by WithAsync could not be drained within the duration configured
+// by WithDrainTimeout.
+var ErrDrainTimeout = errors.New("timeout draining queue")
+
+// asyncWriter is an io.WriteCloser that appends a copy of each chunk written
+// to it to a bounded queue, and writes queued chunks to the underlying
+// io.WriteCloser from a background goroutine.
+type asyncWriter struct {
+	lock           sync.Mutex
+	notEmpty       sync.Cond
+	notFull        sync.Cond
+	queue          [][]byte
+	queueSize      int
+	policy         QueueFullPolicy
+	iowc           io.WriteCloser
+	clock          Clock
+	drainTimeout   time.Duration
+	err            error         // error from background write, reported by next Write
+	closing        bool          // set by Close to stop background goroutine once queue empty
+	done           chan struct{} // closed when background goroutine returns
+	dropped        int           // number of chunks discarded because queue was full
+	delimiter      []byte        // for counting lines in discarded bytes
+	discardedBytes int           // number of bytes accepted by Write but never written
+	discardedLines int           // number of delimiters in discarded bytes
+}
+
+func newAsyncWriter(iowc io.WriteCloser, queueSize int, policy QueueFullPolicy, drainTimeout time.Duration, clock Clock, delimiter []byte) *asyncWriter {
+	aw := &asyncWriter{
+		queue:        make([][]byte, 0, queueSize),
+		queueSize:    queueSize,
+		policy:       policy,
+		iowc:         iowc,
+		clock:        clock,
+		drainTimeout: drainTimeout,
+		done:         make(chan struct{}),
+		delimiter:    delimiter,
+	}
+	aw.notEmpty.L = &aw.lock
+	aw.notFull.L = &aw.lock
+	go aw.run()
+	return aw
+}
+
+// Write appends a copy of p to the queue. When a previous write by the
+// background goroutine failed, it returns that error without queuing p, so the
+// WriteCloser retains the lines for a later flush.
+func (aw *asyncWriter) Write(p []byte) (int, error) {
+	aw.lock.Lock()
+	defer aw.lock.Unlock()
+
+	if aw.err != nil {
+		err := aw.err
+		aw.err = nil
+		return 0, err
+	}
+	if aw.closing {
+		return 0, ErrWriterClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if len(aw.queue) == aw.queueSize {
+		switch aw.policy {
+		case BlockWhenFull:
+			for len(aw.queue) == aw.queueSize && !aw.closing {
+				aw.notFull.Wait()
+			}
+			if aw.closing {
+				return 0, ErrWriterClosed
+			}
+		case DropNewest:
+			aw.dropped++
+			aw.discard(p)
+			return len(p), nil
+		case DropOldest:
+			aw.dropped++
+			aw.discard(aw.queue[0])
+			copy(aw.queue, aw.queue[1:])
+			aw.queue = aw.queue[:len(aw.queue)-1]
+		}
+	}
+
+	aw.queue = append(aw.queue, append([]byte(nil), p...))
+	aw.notEmpty.Signal()
+	return len(p), nil
+}
+
+// run writes queued chunks to the underlying io.WriteCloser until the queue is
+// empty after Close is invoked. When a write fails, the remainder of the chunk
+// is discarded, and the error is reported by the next Write.
+func (aw *asyncWriter) run() {
+	defer close(aw.done)
+
+	for {
+		aw.lock.Lock()
+		for len(aw.queue) == 0 && !aw.closing {
+			aw.notEmpty.Wait()
+		}
+		if len(aw.queue) == 0 {
+			aw.lock.Unlock()
+			return // closing and drained
+		}
+		chunk := aw.queue[0]
+		aw.queue[0] = nil
+		aw.queue = aw.queue[1:]
+		aw.notFull.Signal()
+		aw.lock.Unlock()
+
+		nw, err := aw.iowc.Write(chunk)
+
+		aw.lock.Lock()
+		if err != nil {
+			if nw >= 0 && nw < len(chunk) {
+				aw.discard(chunk[nw:])
+			}
+			if aw.err == nil {
+				aw.err = err
+			}
+		}
+		aw.lock.Unlock()
+	}
+}
+
+// discard counts the bytes and lines of p, which was accepted by Write but will
+// never be written to the underlying io.WriteCloser. It must be invoked with
+// the lock held.
+func (aw *asyncWriter) discard(p []byte) {
+	aw.discardedBytes += len(p)
+	aw.discardedLines += bytes.Count(p, aw.delimiter)
+}
+
+// Close waits for the background goroutine to write all queued chunks, up to
+// the drain timeout when one is configured, then closes the underlying
+// io.WriteCloser. When the drain timeout elapses, the remaining queued chunks
+// are discarded and the returned error wraps ErrDrainTimeout. Even then, Close
+// waits for the background goroutine to finish the chunk it is writing, so the
+// underlying io.WriteCloser is never closed during a Write. Close therefore
+// blocks for as long as that Write does, indefinitely when it never returns.
+func (aw *asyncWriter) Close() error {
+	aw.lock.Lock()
+	aw.closing = true
+	aw.notEmpty.Broadcast()
+	aw.notFull.Broadcast()
+	aw.lock.Unlock()
+
+	var err error
+	if aw.drainTimeout > 0 {
+		expired := make(chan struct{})
+		timer := aw.clock.AfterFunc(aw.drainTimeout, func() { close(expired) })
+		select {
+		case <-aw.done:
+			timer.Stop()
+		case <-expired:
+			aw.lock.Lock()
+			err = fmt.Errorf("%w: discarded %d queued chunks", ErrDrainTimeout, len(aw.queue))
+			for _, chunk := range aw.queue {
+				aw.discard(chunk)
+			}
+			aw.queue = nil // background goroutine returns after in flight write
+			aw.lock.Unlock()
+			<-aw.done
+		}
+	} else {
+		<-aw.done
+	}
+
+	cerr := aw.iowc.Close()
+	if err != nil {
+		return err
+	}
+	aw.lock.Lock()
+	if aw.err != nil {
+		err = aw.err
+		aw.err = nil
+	}
+	aw.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
@@ -0,0 +1,257 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter is an io.WriteCloser whose Write method blocks until the test
+// releases it, to simulate a slow sink.
+type gatedWriter struct {
+	lock    sync.Mutex
+	buf     bytes.Buffer
+	gate    chan struct{} // Write waits to receive from gate
+	started chan struct{} // Write sends to started once invoked
+	closed  bool
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{}), started: make(chan struct{}, 16)}
+}
+
+func (gw *gatedWriter) Write(p []byte) (int, error) {
+	gw.started <- struct{}{}
+	<-gw.gate
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	return gw.buf.Write(p)
+}
+
+func (gw *gatedWriter) Close() error {
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	gw.closed = true
+	return nil
+}
+
+func (gw *gatedWriter) String() string {
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	return gw.buf.String()
+}
+
+// release allows count pending or future calls to Write to proceed.
+func (gw *gatedWriter) release(count int) {
+	for i := 0; i < count; i++ {
+		gw.gate <- struct{}{}
+	}
+}
+
+// slowWriter is an io.WriteCloser whose Write method sleeps before writing,
+// and which records whether it was closed while a Write was in progress.
+type slowWriter struct {
+	buf               bytes.Buffer
+	delay             time.Duration
+	writing           bool
+	closedDuringWrite bool
+}
+
+func (sw *slowWriter) Write(p []byte) (int, error) {
+	sw.writing = true
+	time.Sleep(sw.delay)
+	n, err := sw.buf.Write(p)
+	sw.writing = false
+	return n, err
+}
+
+func (sw *slowWriter) Close() error {
+	sw.closedDuringWrite = sw.writing
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	t.Run("option", func(t *testing.T) {
+		_, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithAsync(0, BlockWhenFull))
+		ensureError(t, err, "queue size")
+
+		_, err = NewWriteCloser(NopCloseWriter(io.Discard), 16, WithAsync(4, QueueFullPolicy(42)))
+		ensureError(t, err, "unknown queue full policy")
+
+		_, err = NewWriteCloser(NopCloseWriter(io.Discard), 16, WithDrainTimeout(0))
+		ensureError(t, err, "drain timeout")
+	})
+
+	t.Run("writes in background and drains on close", func(t *testing.T) {
+		output := new(lockedBuffer)
+		wc, err := NewWriteCloser(output, 1, WithAsync(4, BlockWhenFull))
+		ensureError(t, err)
+
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "partial"} {
+			ensureWrite(t, wc, line)
+		}
+		ensureError(t, wc.Close())
+		if got, want := output.String(), "line 1\nline 2\nline 3\npartial"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+
+	// fill writes the first line, waits for the background goroutine to
+	// start writing it, then writes three more lines, for a queue size of 2.
+	fill := func(t *testing.T, policy QueueFullPolicy) (*WriteCloser, *gatedWriter) {
+		t.Helper()
+		output := newGatedWriter()
+		wc, err := NewWriteCloser(output, 1, WithAsync(2, policy))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+		<-output.started
+		ensureWrite(t, wc, "line 2\n")
+		ensureWrite(t, wc, "line 3\n")
+		return wc, output
+	}
+
+	t.Run("drop newest", func(t *testing.T) {
+		wc, output := fill(t, DropNewest)
+		ensureWrite(t, wc, "line 4\n")
+		go output.release(3)
+		ensureError(t, wc.Close())
+		if got, want := output.String(), "line 1\nline 2\nline 3\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		wc, output := fill(t, DropOldest)
+		ensureWrite(t, wc, "line 4\n")
+		go output.release(3)
+		ensureError(t, wc.Close())
+		if got, want := output.String(), "line 1\nline 3\nline 4\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+
+	t.Run("block when full", func(t *testing.T) {
+		wc, output := fill(t, BlockWhenFull)
+
+		returned := make(chan struct{})
+		go func() {
+			ensureWrite(t, wc, "line 4\n")
+			close(returned)
+		}()
+
+		select {
+		case <-returned:
+			t.Fatal("Write returned while queue full")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		output.release(1)
+		<-returned
+		go output.release(3)
+		ensureError(t, wc.Close())
+		if got, want := output.String(), "line 1\nline 2\nline 3\nline 4\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+
+	t.Run("drain timeout", func(t *testing.T) {
+		clock := newFakeClock()
+		output := newGatedWriter()
+		wc, err := NewWriteCloser(output, 1, WithClock(clock), WithAsync(4, BlockWhenFull), WithDrainTimeout(time.Second))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+		<-output.started
+		ensureWrite(t, wc, "line 2\n")
+		ensureWrite(t, wc, "line 3\n")
+
+		closed := make(chan error)
+		go func() { closed <- wc.Close() }()
+
+		for clock.Pending() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(time.Second)
+
+		// Close waits for background goroutine to complete the write it
+		// started before closing output.
+		select {
+		case err = <-closed:
+			t.Fatalf("Close returned before in flight write completed: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		output.release(1)
+
+		err = <-closed
+		if !errors.Is(err, ErrDrainTimeout) {
+			t.Errorf("GOT: %v; WANT: %v", err, ErrDrainTimeout)
+		}
+		ensureError(t, err, "discarded 2 queued chunks")
+		if got, want := output.String(), "line 1\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		if !output.closed {
+			t.Errorf("GOT: %v; WANT: %v", output.closed, true)
+		}
+	})
+
+	t.Run("drain timeout does not close during write", func(t *testing.T) {
+		// Neither field of slowWriter is protected by a lock, so the race
+		// detector reports when Close is invoked during a Write.
+		output := &slowWriter{delay: 50 * time.Millisecond}
+		wc, err := NewWriteCloser(output, 1, WithAsync(4, BlockWhenFull), WithDrainTimeout(5*time.Millisecond))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+		ensureWrite(t, wc, "line 2\n")
+
+		err = wc.Close()
+		if !errors.Is(err, ErrDrainTimeout) {
+			t.Errorf("GOT: %v; WANT: %v", err, ErrDrainTimeout)
+		}
+		ensureError(t, err, "discarded 1 queued chunks")
+		if output.closedDuringWrite {
+			t.Errorf("closed during write")
+		}
+		if got, want := output.buf.String(), "line 1\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+
+	t.Run("background write error", func(t *testing.T) {
+		wc, err := NewWriteCloser(&errOnWrite{}, 1, WithAsync(4, BlockWhenFull))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+		ensureError(t, wc.Close(), "test write error")
+	})
+
+	t.Run("background write error reported by next flush", func(t *testing.T) {
+		aw := newAsyncWriter(&errOnWrite{}, 4, BlockWhenFull, 0, systemClock{}, []byte("\n"))
+		n, err := aw.Write([]byte("line 1\n"))
+		ensureError(t, err)
+		if got, want := n, 7; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		for {
+			aw.lock.Lock()
+			failed := aw.err != nil
+			aw.lock.Unlock()
+			if failed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		n, err = aw.Write([]byte("line 2\n"))
+		ensureError(t, err, "test write error")
+		if got, want := n, 0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureError(t, aw.Close(), "test close error")
+
+		_, err = aw.Write([]byte("line 3\n"))
+		ensureError(t, err, ErrWriterClosed.Error())
+	})
+}
@@ -30,3 +30,27 @@ func BenchmarkWriteCloser(b *testing.B) {
 		benchmarkIt(b, lfwc)
 	}
 }
+
+func benchmarkParallel(b *testing.B, options ...Option) {
+	lfwc, err := NewWriteCloser(NopCloseWriter(io.Discard), 512, options...)
+	ensureError(b, err)
+	line := []byte("The quick brown fox jumps over the lazy dog.\n")
+	b.SetBytes(int64(len(line)))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := lfwc.Write(line); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	ensureError(b, lfwc.Close())
+}
+
+func BenchmarkWriteCloserParallel(b *testing.B) {
+	benchmarkParallel(b)
+}
+
+func BenchmarkWriteCloserParallelLineAtomic(b *testing.B) {
+	benchmarkParallel(b, WithLineAtomicWrites())
+}
@@ -0,0 +1,34 @@
+package golfw
+
+import "time"
+
+// Clock provides the current time and timers to a WriteCloser. It exists so
+// tests may control the passage of time. Most programs do not need to provide
+// a Clock, because by default a WriteCloser uses the system clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc waits for the duration to elapse and then calls f in its own
+	// goroutine. It returns a Timer that can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+
+	// Sleep pauses the current goroutine for at least the duration d.
+	Sleep(d time.Duration)
+}
+
+// Timer is a cancelable timer returned by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the Timer from firing. It returns true if the call stops
+	// the timer, false if the timer has already expired or been stopped.
+	Stop() bool
+}
+
+// systemClock is the Clock implemented by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
@@ -0,0 +1,103 @@
+package golfw
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a Clock whose time only advances when a test invokes Advance.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	sleeps []time.Duration
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	when    time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2022, time.March, 5, 12, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	ft := &fakeTimer{clock: fc, when: fc.now.Add(d), f: f}
+	fc.timers = append(fc.timers, ft)
+	return ft
+}
+
+// Sleep records the duration, then advances the clock by it.
+func (fc *fakeClock) Sleep(d time.Duration) {
+	fc.lock.Lock()
+	fc.sleeps = append(fc.sleeps, d)
+	fc.lock.Unlock()
+	fc.Advance(d)
+}
+
+// Sleeps returns the durations passed to Sleep.
+func (fc *fakeClock) Sleeps() []time.Duration {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	return append([]time.Duration(nil), fc.sleeps...)
+}
+
+// Advance moves the clock forward by d, and synchronously invokes the
+// function of every timer that expires.
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.lock.Lock()
+	fc.now = fc.now.Add(d)
+	var expired []*fakeTimer
+	var pending []*fakeTimer
+	for _, ft := range fc.timers {
+		switch {
+		case ft.stopped:
+		case !ft.when.After(fc.now):
+			ft.stopped = true
+			expired = append(expired, ft)
+		default:
+			pending = append(pending, ft)
+		}
+	}
+	fc.timers = pending
+	fc.lock.Unlock()
+
+	for _, ft := range expired {
+		ft.f()
+	}
+}
+
+// Pending returns the number of timers that have neither fired nor been
+// stopped.
+func (fc *fakeClock) Pending() int {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	var count int
+	for _, ft := range fc.timers {
+		if !ft.stopped {
+			count++
+		}
+	}
+	return count
+}
+
+func (ft *fakeTimer) Stop() bool {
+	ft.clock.lock.Lock()
+	defer ft.clock.lock.Unlock()
+	if ft.stopped {
+		return false
+	}
+	ft.stopped = true
+	return true
+}
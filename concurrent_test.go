@@ -0,0 +1,129 @@
+package golfw
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer is a bytes.Buffer that records every Write call, to allow
+// tests to verify the underlying io.WriteCloser only receives whole lines.
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buf    bytes.Buffer
+	writes [][]byte // copy of each payload
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.writes = append(lb.writes, append([]byte(nil), p...))
+	return lb.buf.Write(p)
+}
+
+func (lb *lockedBuffer) Close() error { return nil }
+
+func (lb *lockedBuffer) String() string {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return lb.buf.String()
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	const goroutines = 16
+	const linesPerGoroutine = 500
+
+	run := func(t *testing.T, terminate bool, options ...Option) {
+		output := new(lockedBuffer)
+		wc, err := NewWriteCloser(output, 64, options...)
+		ensureError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(goroutines)
+		for g := 0; g < goroutines; g++ {
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < linesPerGoroutine; i++ {
+					line := fmt.Sprintf("goroutine %d line %d", g, i)
+					if terminate {
+						line += "\n"
+					}
+					if _, err := wc.Write([]byte(line)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		ensureError(t, wc.Close())
+
+		for _, p := range output.writes {
+			if !bytes.HasSuffix(p, []byte("\n")) {
+				t.Fatalf("write without final LF: %q", p)
+			}
+		}
+
+		seen := make(map[string]struct{}, goroutines*linesPerGoroutine)
+		scanner := bufio.NewScanner(bytes.NewReader([]byte(output.String())))
+		for scanner.Scan() {
+			line := scanner.Text()
+			var g, i int
+			if _, err := fmt.Sscanf(line, "goroutine %d line %d", &g, &i); err != nil {
+				t.Fatalf("spliced line: %q", line)
+			}
+			if got, want := line, fmt.Sprintf("goroutine %d line %d", g, i); got != want {
+				t.Fatalf("GOT: %q; WANT: %q", got, want)
+			}
+			seen[line] = struct{}{}
+		}
+		if got, want := len(seen), goroutines*linesPerGoroutine; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	}
+
+	t.Run("terminated lines", func(t *testing.T) {
+		run(t, true)
+	})
+	t.Run("line atomic writes", func(t *testing.T) {
+		run(t, false, WithLineAtomicWrites())
+	})
+}
+
+func TestLineAtomicWrites(t *testing.T) {
+	t.Run("appends LF when missing", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 64, WithLineAtomicWrites())
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1", wantState{
+			buf:                 "line 1\n",
+			n:                   6,
+			indexOfFinalNewline: 6,
+		})
+		ensureWriteResponse(t, wc, "line 2\n", wantState{
+			buf:                 "line 1\nline 2\n",
+			n:                   7,
+			indexOfFinalNewline: 13,
+		})
+		ensureWriteResponse(t, wc, "", wantState{
+			buf:                 "line 1\nline 2\n",
+			indexOfFinalNewline: 13,
+		})
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\nline 2\n")
+	})
+	t.Run("appended LF does not inflate count on error", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 7)), 4, WithLineAtomicWrites())
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1", wantState{
+			n:                   6,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "line 1\n")
+	})
+}
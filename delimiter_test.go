@@ -0,0 +1,152 @@
+package golfw
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDelimiter(t *testing.T) {
+	t.Run("option", func(t *testing.T) {
+		_, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithDelimiter(nil))
+		ensureError(t, err, "empty delimiter")
+	})
+
+	t.Run("option copies delimiter", func(t *testing.T) {
+		delimiter := []byte{0}
+		wc, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithDelimiter(delimiter))
+		ensureError(t, err)
+		delimiter[0] = 'x'
+		if got, want := wc.delimiter, []byte{0}; !bytes.Equal(got, want) {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+
+	t.Run("NUL", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 8, WithDelimiter([]byte{0}))
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "./a\n\x00./b", wantState{
+			buf:                 "./a\n\x00./b",
+			n:                   8,
+			indexOfFinalNewline: 4,
+		})
+		ensureWriteResponse(t, wc, "\x00./c", wantState{
+			buf:                 "./c",
+			n:                   4,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "./a\n\x00./b\x00")
+	})
+
+	t.Run("RS", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 8, WithDelimiter([]byte{0x1e}))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "{\"a\":1}\n\x1e{\"b\":\n2}\n\x1e")
+		ensureBuffer(t, output, "{\"a\":1}\n\x1e{\"b\":\n2}\n\x1e")
+	})
+
+	t.Run("CRLF", func(t *testing.T) {
+		t.Run("within single write", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 8, WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "line\n1\r\nline 2", wantState{
+				buf:                 "line 2",
+				n:                   14,
+				indexOfFinalNewline: -1,
+			})
+			ensureBuffer(t, output, "line\n1\r\n")
+		})
+
+		t.Run("split across writes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 8, WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "line 1\r", wantState{
+				buf:                 "line 1\r",
+				n:                   7,
+				indexOfFinalNewline: -1,
+			})
+			ensureWriteResponse(t, wc, "\nline 2", wantState{
+				buf:                 "line 2",
+				n:                   7,
+				indexOfFinalNewline: -1,
+			})
+			ensureBuffer(t, output, "line 1\r\n")
+		})
+
+		t.Run("previous delimiter not found twice", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 64, WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "line 1\r\n", wantState{
+				buf:                 "line 1\r\n",
+				n:                   8,
+				indexOfFinalNewline: 7,
+			})
+			ensureWriteResponse(t, wc, "line 2", wantState{
+				buf:                 "line 1\r\nline 2",
+				n:                   6,
+				indexOfFinalNewline: 7,
+			})
+		})
+
+		t.Run("write error", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 20, WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+			ensureWrite(t, wc, "line 1\r\nline 2\r\n")
+
+			ensureWriteResponse(t, wc, "line 3\r\n", wantState{
+				buf:                 " 1\r\nline 2\r\n",
+				n:                   0,
+				indexOfFinalNewline: 11,
+				isShortWrite:        true,
+			})
+			ensureBuffer(t, output, "line")
+		})
+
+		t.Run("line atomic writes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 64, WithDelimiter([]byte("\r\n")), WithLineAtomicWrites())
+			ensureError(t, err)
+
+			ensureWrite(t, wc, "line 1\n")
+			ensureWrite(t, wc, "line 2\r\n")
+			ensureError(t, wc.Close())
+			ensureBuffer(t, output, "line 1\n\r\nline 2\r\n")
+		})
+
+		t.Run("multiplexer", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1, WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+			mux := NewMultiplexer(wc)
+
+			a := mux.Writer()
+			b := mux.Writer()
+
+			_, err = a.Write([]byte("alpha\r"))
+			ensureError(t, err)
+			_, err = b.Write([]byte("bravo\n"))
+			ensureError(t, err)
+			ensureBuffer(t, output, "")
+
+			_, err = a.Write([]byte("\nalpha 2"))
+			ensureError(t, err)
+			ensureBuffer(t, output, "alpha\r\n")
+
+			ensureError(t, a.Close())
+			ensureError(t, b.Close())
+			ensureError(t, mux.Close())
+			ensureBuffer(t, output, "alpha\r\nalpha 2\r\nbravo\n\r\n")
+		})
+	})
+}
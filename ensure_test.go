@@ -3,25 +3,14 @@ package golfw
 import (
 	"bytes"
 	"io"
-	"strings"
 	"testing"
+
+	"github.com/karrick/golfw/internal/ensure"
 )
 
 func ensureError(tb testing.TB, err error, contains ...string) {
 	tb.Helper()
-	if len(contains) == 0 || (len(contains) == 1 && contains[0] == "") {
-		if err != nil {
-			tb.Fatalf("GOT: %v; WANT: %v", err, contains)
-		}
-	} else if err == nil {
-		tb.Errorf("GOT: %v; WANT: %v", err, contains)
-	} else {
-		for _, stub := range contains {
-			if stub != "" && !strings.Contains(err.Error(), stub) {
-				tb.Errorf("GOT: %v; WANT: %q", err, stub)
-			}
-		}
-	}
+	ensure.Error(tb, err, contains...)
 }
 
 func ensureBuffer(tb testing.TB, got *bytes.Buffer, want string) {
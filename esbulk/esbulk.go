@@ -0,0 +1,327 @@
+// Package esbulk provides a writer that indexes each line written to it as a
+// document in Elasticsearch or OpenSearch, using the _bulk API. It is designed
+// to be the underlying io.WriteCloser of a golfw.WriteCloser, which already
+// batches complete lines, so each flush becomes a single bulk request.
+//
+//     func Example() error {
+//         bw, err := esbulk.New("http://localhost:9200", "logs", nil)
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(bw, 1<<20)
+//         if err != nil {
+//             _ = bw.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes bw.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karrick/golfw"
+)
+
+// Defaults of the retry policy used when Options does not specify one.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultJitter         = 0.2
+)
+
+// Options configures a Writer.
+type Options struct {
+	// Client is used to send bulk requests. When nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	// Header holds additional headers sent with each bulk request, for
+	// instance Authorization.
+	Header http.Header
+
+	// Retry determines the maximum number of attempts to index each
+	// document, including the initial attempt, and the backoff between
+	// attempts. Only documents that failed with a retryable status, 429 or
+	// 5xx, are sent again, so its Retryable field is ignored. When nil, the
+	// policy described by the Default constants is used.
+	Retry *golfw.RetryPolicy
+
+	// Delimiter is the record delimiter of the chunks written to the Writer.
+	// When empty, LF is used.
+	Delimiter []byte
+}
+
+// ItemError describes a document that could not be indexed.
+type ItemError struct {
+	// Line is the line from which the document was created.
+	Line string
+
+	// Status is the HTTP status of the item in the bulk response, or of the
+	// entire bulk response when the request failed.
+	Status int
+
+	// Type and Reason describe the error, as reported by the cluster.
+	Type   string
+	Reason string
+}
+
+// BulkError is returned by Write when one or more documents could not be
+// indexed.
+type BulkError struct {
+	// Items describes each document that could not be indexed.
+	Items []ItemError
+}
+
+func (e *BulkError) Error() string {
+	first := e.Items[0]
+	return fmt.Sprintf("cannot index %d documents: first failed with status %d: %s: %s", len(e.Items), first.Status, first.Type, first.Reason)
+}
+
+// Writer is an io.WriteCloser that indexes each line written to it as a
+// document, sending each chunk of lines with a single bulk request. Lines that
+// are JSON objects are indexed as they are, while other lines are wrapped as
+// the message field of a document. Empty lines are not indexed. Its methods
+// are safe to invoke from multiple goroutines.
+type Writer struct {
+	lock    sync.Mutex
+	url     string
+	action  []byte // action line for each document
+	options Options
+	docs    [][]byte // reused for the documents of a chunk
+	lines   [][]byte // reused for the line of each document
+	body    bytes.Buffer
+	retry   golfw.RetryPolicy
+	closed  bool
+	sleep   func(time.Duration)
+}
+
+// New returns a Writer that indexes documents in the specified index of the
+// cluster at url, for instance "http://localhost:9200". When options is nil,
+// the defaults described by Options are used.
+func New(url, index string, options *Options) (*Writer, error) {
+	if index == "" {
+		return nil, errors.New("cannot create Writer with empty index")
+	}
+	w := &Writer{url: strings.TrimSuffix(url, "/") + "/_bulk", sleep: time.Sleep}
+	if options != nil {
+		w.options = *options
+	}
+	w.retry = golfw.RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Jitter:         DefaultJitter,
+	}
+	if w.options.Retry != nil {
+		w.retry = *w.options.Retry
+	}
+	if err := w.retry.Validate(); err != nil {
+		return nil, fmt.Errorf("cannot create Writer: %w", err)
+	}
+	if w.options.Client == nil {
+		w.options.Client = http.DefaultClient
+	}
+	if len(w.options.Delimiter) == 0 {
+		w.options.Delimiter = []byte{'\n'}
+	}
+	action, err := json.Marshal(map[string]map[string]string{"index": {"_index": index}})
+	if err != nil {
+		return nil, err
+	}
+	w.action = action
+	return w, nil
+}
+
+// document returns the document for line: the line itself, compacted to a
+// single line of NDJSON, when it is a JSON object, otherwise a JSON object with
+// the line as its message field.
+func document(line []byte) []byte {
+	if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] == '{' {
+		var doc bytes.Buffer
+		if err := json.Compact(&doc, trimmed); err == nil {
+			return doc.Bytes()
+		}
+	}
+	doc, _ := json.Marshal(struct {
+		Message string `json:"message"`
+	}{string(line)}) // cannot fail
+	return doc
+}
+
+// bulkResponse is the part of a bulk response used to find failed items.
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// retryable returns true when a document that failed with status may be
+// indexed when sent again.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Write indexes each line of p as a document with a single bulk request. When
+// some documents fail with a retryable status, only those documents are sent
+// again, as allowed by the retry policy. Because each document is indexed at
+// most once, Write reports all of p as written even when it returns an error.
+// When documents could not be indexed, the returned error is a *BulkError.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	w.docs, w.lines = w.docs[:0], w.lines[:0]
+	_ = golfw.EachLine(p, w.options.Delimiter, func(line, _ []byte) error {
+		if len(bytes.TrimSpace(line)) > 0 {
+			w.docs = append(w.docs, document(line))
+			w.lines = append(w.lines, line)
+		}
+		return nil
+	})
+
+	pending := make([]int, len(w.docs)) // indexes of documents to send
+	for i := range pending {
+		pending[i] = i
+	}
+	var failed []ItemError
+	for attempt := 1; len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			w.sleep(w.retry.Backoff(attempt - 1))
+		}
+		retry, errs := w.send(pending)
+		last := attempt >= w.retry.MaxAttempts
+		for _, item := range errs {
+			if last || !retryable(item.Status) {
+				failed = append(failed, item)
+			}
+		}
+		if last {
+			break
+		}
+		pending = retry
+	}
+	for i := range w.docs {
+		w.docs[i], w.lines[i] = nil, nil
+	}
+	if len(failed) > 0 {
+		return len(p), &BulkError{Items: failed}
+	}
+	return len(p), nil
+}
+
+// send sends the specified documents with a bulk request, and returns the
+// indexes of the documents that failed with a retryable status, along with
+// an ItemError for every document that failed.
+func (w *Writer) send(indexes []int) ([]int, []ItemError) {
+	w.body.Reset()
+	for _, i := range indexes {
+		w.body.Write(w.action)
+		w.body.WriteByte('\n')
+		w.body.Write(w.docs[i])
+		w.body.WriteByte('\n')
+	}
+
+	// failAll returns every document as failed with the same error.
+	failAll := func(status int, typ, reason string) ([]int, []ItemError) {
+		var retry []int
+		errs := make([]ItemError, len(indexes))
+		for j, i := range indexes {
+			errs[j] = ItemError{Line: string(w.lines[i]), Status: status, Type: typ, Reason: reason}
+			if retryable(status) {
+				retry = append(retry, i)
+			}
+		}
+		return retry, errs
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(w.body.Bytes()))
+	if err != nil {
+		return failAll(0, "request_error", err.Error())
+	}
+	for key, values := range w.options.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := w.options.Client.Do(req)
+	if err != nil {
+		// Transport errors are retryable.
+		return failAll(http.StatusServiceUnavailable, "transport_error", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return failAll(resp.StatusCode, "http_error", strings.TrimSpace(string(reason)))
+	}
+	var br bulkResponse
+	if err = json.NewDecoder(resp.Body).Decode(&br); err != nil {
+		return failAll(0, "response_error", err.Error())
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if !br.Errors {
+		return nil, nil
+	}
+	if len(br.Items) != len(indexes) {
+		return failAll(0, "response_error", fmt.Sprintf("response has %d items rather than %d", len(br.Items), len(indexes)))
+	}
+
+	var retry []int
+	var errs []ItemError
+	for j, item := range br.Items {
+		for _, result := range item { // single key naming the action
+			if result.Status/100 == 2 {
+				continue
+			}
+			ie := ItemError{Line: string(w.lines[indexes[j]]), Status: result.Status}
+			if result.Error != nil {
+				ie.Type, ie.Reason = result.Error.Type, result.Error.Reason
+			}
+			errs = append(errs, ie)
+			if retryable(result.Status) {
+				retry = append(retry, indexes[j])
+			}
+		}
+	}
+	return retry, errs
+}
+
+// Close causes subsequent writes to fail. It does not close the idle
+// connections of the HTTP client, which may be shared.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,190 @@
+package esbulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+// fakeCluster is an http.Handler that stands in for the _bulk API. It fails
+// documents containing "retry" with status 429 the first time they are sent,
+// and documents containing "bad" with status 400.
+type fakeCluster struct {
+	lock     sync.Mutex
+	requests [][]string // documents of each request
+	indexed  []string
+	retried  map[string]bool
+	status   int // when non-zero, status of every response
+}
+
+func (fc *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if fc.status != 0 {
+		http.Error(w, "unavailable", fc.status)
+		return
+	}
+	var docs []string
+	var items []string
+	var errs bool
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		if action := scanner.Text(); action != `{"index":{"_index":"logs"}}` {
+			http.Error(w, "bad action: "+action, http.StatusBadRequest)
+			return
+		}
+		scanner.Scan()
+		doc := scanner.Text()
+		docs = append(docs, doc)
+		switch {
+		case strings.Contains(doc, "retry") && !fc.retried[doc]:
+			fc.retried[doc] = true
+			errs = true
+			items = append(items, `{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}`)
+		case strings.Contains(doc, "bad"):
+			errs = true
+			items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+		default:
+			fc.indexed = append(fc.indexed, doc)
+			items = append(items, `{"index":{"status":201}}`)
+		}
+	}
+	fc.requests = append(fc.requests, docs)
+	fmt.Fprintf(w, `{"took":1,"errors":%v,"items":[%s]}`, errs, strings.Join(items, ","))
+}
+
+func newTestWriter(tb testing.TB, options *Options) (*Writer, *fakeCluster) {
+	tb.Helper()
+	fc := &fakeCluster{retried: make(map[string]bool)}
+	server := httptest.NewServer(fc)
+	tb.Cleanup(server.Close)
+	bw, err := New(server.URL+"/", "logs", options)
+	ensure.Error(tb, err)
+	return bw, fc
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("http://localhost:9200", "", nil)
+	ensure.Error(t, err, "empty index")
+	_, err = New("http://localhost:9200", "logs", &Options{Retry: &golfw.RetryPolicy{}})
+	ensure.Error(t, err, "max attempts")
+}
+
+func TestDocument(t *testing.T) {
+	tests := []struct{ line, want string }{
+		{`{"level":"info"}`, `{"level":"info"}`},
+		{` {"level":"info"} `, `{"level":"info"}`},
+		{`plain "text"`, `{"message":"plain \"text\""}`},
+		{`{"unterminated":`, `{"message":"{\"unterminated\":"}`},
+		{`[1,2]`, `{"message":"[1,2]"}`},
+		{"{\n  \"a\": 1\n}", `{"a":1}`},
+	}
+	for _, test := range tests {
+		if got := string(document([]byte(test.line))); got != test.want {
+			t.Errorf("GOT: %s; WANT: %s", got, test.want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("one request per flush", func(t *testing.T) {
+		bw, fc := newTestWriter(t, nil)
+		lf, err := golfw.NewWriteCloser(bw, 1024)
+		ensure.Error(t, err)
+
+		_, err = lf.Write([]byte("{\"level\":\"info\"}\nplain\n\npartial"))
+		ensure.Error(t, err)
+		ensure.Error(t, lf.Close())
+		if got, want := len(fc.requests), 1; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Strings(t, fc.indexed, `{"level":"info"}`, `{"message":"plain"}`, `{"message":"partial"}`)
+		ensure.Error(t, bw.Close(), "closed")
+	})
+
+	t.Run("multi-line JSON record", func(t *testing.T) {
+		bw, fc := newTestWriter(t, &Options{Delimiter: []byte{0x1e}})
+
+		_, err := bw.Write([]byte("{\n  \"a\": 1\n}\x1eplain\r\ntext\x1e"))
+		ensure.Error(t, err)
+		ensure.Strings(t, fc.indexed, `{"a":1}`, `{"message":"plain\r\ntext"}`)
+	})
+
+	t.Run("retries only failed items", func(t *testing.T) {
+		bw, fc := newTestWriter(t, &Options{Retry: &golfw.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second}})
+		var sleeps []time.Duration
+		bw.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+		n, err := bw.Write([]byte("a\nretry b\nbad c\nd\n"))
+		if got, want := n, 18; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		var be *BulkError
+		if !errors.As(err, &be) {
+			t.Fatalf("GOT: %v; WANT: %T", err, be)
+		}
+		if got, want := len(be.Items), 1; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := be.Items[0], (ItemError{Line: "bad c", Status: 400, Type: "mapper_parsing_exception", Reason: "failed to parse"}); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		if got, want := len(fc.requests), 2; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Strings(t, fc.requests[1], `{"message":"retry b"}`)
+		ensure.Strings(t, fc.indexed, `{"message":"a"}`, `{"message":"d"}`, `{"message":"retry b"}`)
+		if got, want := fmt.Sprint(sleeps), "[1s]"; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("request failure", func(t *testing.T) {
+		bw, fc := newTestWriter(t, &Options{Retry: &golfw.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}})
+		fc.status = http.StatusServiceUnavailable
+		var sleeps []time.Duration
+		bw.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+		_, err := bw.Write([]byte("a\nb\n"))
+		ensure.Error(t, err, "cannot index 2 documents: first failed with status 503: http_error: unavailable")
+		if got, want := fmt.Sprint(sleeps), "[1s 2s 3s]"; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		var got string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Authorization")
+			var buf bytes.Buffer
+			_, _ = buf.ReadFrom(r.Body)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": false})
+		}))
+		defer server.Close()
+
+		bw, err := New(server.URL, "logs", &Options{Header: http.Header{"Authorization": {"ApiKey secret"}}})
+		ensure.Error(t, err)
+		_, err = bw.Write([]byte("a\n"))
+		ensure.Error(t, err)
+		if want := "ApiKey secret"; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+}
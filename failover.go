@@ -0,0 +1,185 @@
+package golfw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultProbeInterval is the duration a Failover writes to its secondary
+// before it probes its primary, when FailoverOptions does not specify one.
+const DefaultProbeInterval = 30 * time.Second
+
+// FailoverOptions configures a Failover.
+type FailoverOptions struct {
+	// ProbeInterval is the duration a Failover writes to its secondary after
+	// a failed write to its primary, before it again attempts to write to its
+	// primary. When zero, DefaultProbeInterval is used.
+	ProbeInterval time.Duration
+
+	// Delimiter is the record delimiter of the chunks written to the
+	// Failover. When empty, LF is used.
+	Delimiter []byte
+
+	// Clock is used to determine when to probe the primary. When nil, the
+	// system clock is used.
+	Clock Clock
+
+	// OnFailover, when not nil, is invoked with the error returned by the
+	// primary each time the Failover switches to its secondary. It is invoked
+	// by Write after the Failover is unlocked, so it may invoke the methods of
+	// the Failover.
+	OnFailover func(error)
+
+	// OnFailback, when not nil, is invoked each time the Failover switches
+	// back to its primary. Like OnFailover, it is invoked by Write after the
+	// Failover is unlocked.
+	OnFailback func()
+}
+
+// Failover is an io.WriteCloser that writes to a primary io.WriteCloser, and
+// when a write to the primary fails, writes to a secondary io.WriteCloser
+// instead, for instance a local file while a socket is down. While writing to
+// the secondary, it periodically probes the primary by writing to it again,
+// and fails back to the primary once a write succeeds. Its methods are safe to
+// invoke from multiple goroutines.
+//
+// It is designed to be the underlying io.WriteCloser of a WriteCloser, which
+// only hands it chunks of complete lines. When a failed write to the primary
+// wrote part of a line, the secondary receives that entire line, so the
+// secondary never holds a torn line, and no line is lost.
+//
+//     func Example(conn net.Conn) error {
+//         fh, err := os.OpenFile("fallback.log", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+//         if err != nil {
+//             return err
+//         }
+//         fo := golfw.NewFailover(conn, fh, &golfw.FailoverOptions{ProbeInterval: time.Minute})
+//         lf, err := golfw.NewWriteCloser(fo, 16384)
+//         if err != nil {
+//             _ = fo.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes conn and fh.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+type Failover struct {
+	lock        sync.Mutex
+	primary     io.WriteCloser
+	secondary   io.WriteCloser
+	options     FailoverOptions
+	onSecondary bool      // true after a failed write to primary
+	nextProbe   time.Time // when primary is next attempted
+	closed      bool
+}
+
+// NewFailover returns a Failover that writes to primary, and to secondary
+// while primary is failing. When options is nil, the defaults described by
+// FailoverOptions are used.
+func NewFailover(primary, secondary io.WriteCloser, options *FailoverOptions) *Failover {
+	f := &Failover{primary: primary, secondary: secondary}
+	if options != nil {
+		f.options = *options
+	}
+	if f.options.ProbeInterval <= 0 {
+		f.options.ProbeInterval = DefaultProbeInterval
+	}
+	if len(f.options.Delimiter) == 0 {
+		f.options.Delimiter = []byte{'\n'}
+	}
+	if f.options.Clock == nil {
+		f.options.Clock = systemClock{}
+	}
+	return f
+}
+
+// UsingSecondary returns true while the Failover is writing to its secondary.
+func (f *Failover) UsingSecondary() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.onSecondary
+}
+
+// Write writes p to the primary, unless the Failover is using its secondary
+// and the probe interval has not yet elapsed. When the write to the primary
+// fails, the bytes of p from the start of the first line the primary did not
+// completely write are written to the secondary. It returns an error only when
+// the write to the secondary also fails.
+func (f *Failover) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	n, notify, err := f.write(p)
+	f.lock.Unlock()
+	if notify != nil {
+		notify()
+	}
+	return n, err
+}
+
+// write writes p as described by Write. It also returns the OnFailover or
+// OnFailback callback to invoke once the Failover is unlocked, if any. It must
+// be invoked with the lock held.
+func (f *Failover) write(p []byte) (int, func(), error) {
+	if f.closed {
+		return 0, nil, os.ErrClosed
+	}
+
+	var notify func()
+
+	var start int // index of first byte of p not written to primary
+	if !f.onSecondary || !f.options.Clock.Now().Before(f.nextProbe) {
+		nw, err := f.primary.Write(p)
+		if err == nil && nw < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			if f.onSecondary {
+				f.onSecondary = false
+				notify = f.options.OnFailback
+			}
+			return nw, notify, nil
+		}
+		if !f.onSecondary {
+			f.onSecondary = true
+			if onFailover := f.options.OnFailover; onFailover != nil {
+				notify = func() { onFailover(err) }
+			}
+		}
+		f.nextProbe = f.options.Clock.Now().Add(f.options.ProbeInterval)
+
+		// Resend the torn line, if any, from its first byte.
+		if i := bytes.LastIndex(p[:nw], f.options.Delimiter); i >= 0 {
+			start = i + len(f.options.Delimiter)
+		}
+	}
+
+	nw, err := f.secondary.Write(p[start:])
+	if err != nil {
+		return start + nw, notify, fmt.Errorf("cannot write to secondary: %w", err)
+	}
+	return start + nw, notify, nil
+}
+
+// Close closes both the primary and the secondary, returning the error from
+// closing the primary, if any, otherwise the error from closing the secondary.
+func (f *Failover) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	pe := f.primary.Close()
+	se := f.secondary.Close()
+	if pe == nil {
+		return se
+	}
+	return pe
+}
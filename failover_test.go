@@ -0,0 +1,111 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFailover(t *testing.T) {
+	t.Run("fails over without tearing lines", func(t *testing.T) {
+		primary := new(bytes.Buffer)
+		secondary := new(bytes.Buffer)
+		pw := &failAfterWriter{Writer: primary, max: 10, err: errors.New("test write error")}
+		var failovers []error
+		var fo *Failover
+		fo = NewFailover(pw, NopCloseWriter(secondary), &FailoverOptions{
+			Clock: newFakeClock(),
+			OnFailover: func(err error) {
+				// Callback may invoke methods of the Failover.
+				if fo.UsingSecondary() {
+					failovers = append(failovers, err)
+				}
+			},
+		})
+
+		n, err := fo.Write([]byte("line 1\nline 2\nline 3\n"))
+		ensureError(t, err)
+		if got, want := n, 21; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureBuffer(t, primary, "line 1\nlin")
+		ensureBuffer(t, secondary, "line 2\nline 3\n")
+		if got, want := len(failovers), 1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if !fo.UsingSecondary() {
+			t.Errorf("GOT: %v; WANT: %v", false, true)
+		}
+	})
+
+	t.Run("probes and fails back", func(t *testing.T) {
+		primary := new(bytes.Buffer)
+		secondary := new(bytes.Buffer)
+		clock := newFakeClock()
+		pw := &failAfterWriter{Writer: primary, err: errors.New("test write error")}
+		var failbacks int
+		var fo *Failover
+		fo = NewFailover(pw, NopCloseWriter(secondary), &FailoverOptions{
+			ProbeInterval: time.Minute,
+			Clock:         clock,
+			OnFailback: func() {
+				if !fo.UsingSecondary() {
+					failbacks++
+				}
+			},
+		})
+
+		_, err := fo.Write([]byte("line 1\n"))
+		ensureError(t, err)
+		ensureBuffer(t, secondary, "line 1\n")
+
+		// Primary is not probed before interval elapses.
+		pw.max = 1024
+		clock.Advance(time.Minute - time.Nanosecond)
+		_, err = fo.Write([]byte("line 2\n"))
+		ensureError(t, err)
+		ensureBuffer(t, primary, "")
+		ensureBuffer(t, secondary, "line 1\nline 2\n")
+
+		clock.Advance(time.Nanosecond)
+		_, err = fo.Write([]byte("line 3\n"))
+		ensureError(t, err)
+		ensureBuffer(t, primary, "line 3\n")
+		ensureBuffer(t, secondary, "line 1\nline 2\n")
+		if fo.UsingSecondary() {
+			t.Errorf("GOT: %v; WANT: %v", true, false)
+		}
+		if got, want := failbacks, 1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("secondary fails", func(t *testing.T) {
+		primary := new(bytes.Buffer)
+		pw := &failAfterWriter{Writer: primary, max: 7, err: errors.New("test write error")}
+		sw := &failAfterWriter{Writer: new(bytes.Buffer), err: errors.New("test secondary error")}
+		fo := NewFailover(pw, sw, nil)
+
+		n, err := fo.Write([]byte("line 1\nline 2\n"))
+		ensureError(t, err, "test secondary error")
+		if got, want := n, 7; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("under WriteCloser", func(t *testing.T) {
+		primary := new(bytes.Buffer)
+		secondary := new(bytes.Buffer)
+		pw := &failAfterWriter{Writer: primary, max: 3, err: errors.New("test write error")}
+		fo := NewFailover(pw, NopCloseWriter(secondary), &FailoverOptions{Clock: newFakeClock()})
+		wc, err := NewWriteCloser(fo, 8)
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\nline 2\npartial")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, primary, "lin")
+		ensureBuffer(t, secondary, "line 1\nline 2\npartial")
+		ensureError(t, fo.Close(), "closed")
+	})
+}
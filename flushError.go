@@ -0,0 +1,42 @@
+package golfw
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// FlushError is returned by a WriteCloser configured by WithStrictFlushes when
+// a write to the underlying io.WriteCloser fails. It reports exactly what the
+// failed flush wrote, while all unwritten bytes remain in the buffer, so a
+// later flush resumes with the first unwritten byte, without duplication or
+// gaps.
+type FlushError struct {
+	// LinesWritten is the number of complete lines the failed flush wrote.
+	LinesWritten int
+
+	// BytesWritten is the number of bytes the failed flush wrote. When it
+	// includes only some of the bytes of a line, the remaining bytes of that
+	// line are the first bytes written by the next flush.
+	BytesWritten int
+
+	// Err is the error returned by the underlying io.WriteCloser, or
+	// io.ErrShortWrite when it wrote fewer bytes without returning an error.
+	Err error
+}
+
+func (e *FlushError) Error() string {
+	return fmt.Sprintf("cannot flush: wrote %d complete lines (%d bytes): %s", e.LinesWritten, e.BytesWritten, e.Err)
+}
+
+// Unwrap returns the error returned by the underlying io.WriteCloser.
+func (e *FlushError) Unwrap() error { return e.Err }
+
+// flushError returns a FlushError describing a failed write of the first bytes
+// of the buffer, of which nw bytes were written.
+func (lbf *WriteCloser) flushError(nw int, err error) *FlushError {
+	return &FlushError{
+		LinesWritten: bytes.Count(lbf.buf[:nw], lbf.delimiter),
+		BytesWritten: nw,
+		Err:          err,
+	}
+}
@@ -0,0 +1,97 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func ensureFlushError(tb testing.TB, err error, lines, written int) {
+	tb.Helper()
+	var fe *FlushError
+	if !errors.As(err, &fe) {
+		tb.Fatalf("GOT: %v; WANT: %T", err, fe)
+	}
+	if got, want := fe.LinesWritten, lines; got != want {
+		tb.Errorf("LinesWritten GOT: %v; WANT: %v", got, want)
+	}
+	if got, want := fe.BytesWritten, written; got != want {
+		tb.Errorf("BytesWritten GOT: %v; WANT: %v", got, want)
+	}
+}
+
+func TestStrictFlushes(t *testing.T) {
+	t.Run("retains unwritten lines", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, max: 10, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 8, WithStrictFlushes())
+		ensureError(t, err)
+
+		n, err := wc.Write([]byte("line 1\nline 2\nline 3\nline 4"))
+		if got, want := n, 27; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureFlushError(t, err, 1, 10)
+		if !errors.Is(err, io.ErrShortWrite) {
+			t.Errorf("GOT: %v; WANT: %v", err, io.ErrShortWrite)
+		}
+		ensureBuffer(t, output, "line 1\nlin")
+		if got, want := string(wc.buf), "e 2\nline 3\nline 4"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		if got, want := wc.indexOfFinalNewline, 10; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		fw.max = 1024
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3\nline 4")
+	})
+
+	t.Run("nothing written", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 10, WithStrictFlushes())
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		n, err := wc.Write([]byte("line 2\n"))
+		if got, want := n, 7; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureFlushError(t, err, 0, 0)
+		if got, want := string(wc.buf), "line 1\nline 2\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+
+		fw.max = 1024
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "line 1\nline 2\n")
+	})
+
+	t.Run("close", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, max: 9, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 1024, WithStrictFlushes())
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\nline 2")
+		ensureFlushError(t, wc.Close(), 1, 9)
+	})
+
+	t.Run("without option", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, max: 10, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 8)
+		ensureError(t, err)
+
+		_, err = wc.Write([]byte("line 1\nline 2\n"))
+		var fe *FlushError
+		if errors.As(err, &fe) {
+			t.Errorf("GOT: %v; WANT: %v", err, fw.err)
+		}
+	})
+}
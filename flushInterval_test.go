@@ -0,0 +1,125 @@
+package golfw
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFlushInterval(t *testing.T) {
+	t.Run("option", func(t *testing.T) {
+		_, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithFlushInterval(0))
+		ensureError(t, err, "flush interval")
+
+		_, err = NewWriteCloser(NopCloseWriter(io.Discard), 16, WithClock(nil))
+		ensureError(t, err, "nil Clock")
+	})
+
+	t.Run("flushes completed lines after interval", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithClock(clock), WithFlushInterval(time.Second))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "partial")
+		if got, want := clock.Pending(), 0; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+
+		ensureWrite(t, wc, " line 1\nline 2")
+		if got, want := clock.Pending(), 1; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+
+		clock.Advance(500 * time.Millisecond)
+		ensureWrite(t, wc, "\nline 3")
+		ensureBuffer(t, output, "")
+		if got, want := clock.Pending(), 1; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+
+		clock.Advance(500 * time.Millisecond)
+		ensureBuffer(t, output, "partial line 1\nline 2\n")
+		if got, want := string(wc.buf), "line 3"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		if got, want := wc.indexOfFinalNewline, -1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := clock.Pending(), 0; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "partial line 1\nline 2\nline 3")
+	})
+
+	t.Run("threshold flush leaves timer harmless", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 8, WithClock(clock), WithFlushInterval(time.Second))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		ensureWrite(t, wc, "line 2\n")
+		ensureBuffer(t, output, "line 1\nline 2\n")
+
+		clock.Advance(time.Second)
+		ensureBuffer(t, output, "line 1\nline 2\n")
+		ensureError(t, wc.Close())
+	})
+
+	t.Run("failed flush is retried", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 1024, WithClock(clock), WithFlushInterval(time.Second))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		clock.Advance(time.Second)
+		ensureBuffer(t, output, "line")
+		if got, want := string(wc.buf), " 1\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		if got, want := clock.Pending(), 1; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+
+		clock.Advance(time.Second)
+		ensureBuffer(t, output, "line 1\n")
+		if got, want := clock.Pending(), 0; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("close stops timer", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithClock(clock), WithFlushInterval(time.Second))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\n")
+		if got, want := clock.Pending(), 0; got != want {
+			t.Errorf("PENDING TIMERS: GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("system clock", func(t *testing.T) {
+		output := new(lockedBuffer)
+		wc, err := NewWriteCloser(output, 1024, WithFlushInterval(time.Millisecond))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		deadline := time.Now().Add(5 * time.Second)
+		for output.String() == "" && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got, want := output.String(), "line 1\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		ensureError(t, wc.Close())
+	})
+}
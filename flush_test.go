@@ -0,0 +1,86 @@
+package golfw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFlush(t *testing.T) {
+	t.Run("empty buffer", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024)
+		ensureError(t, err)
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "")
+	})
+
+	t.Run("buf has no newlines", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024)
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1")
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "")
+		ensureWriteResponse(t, wc, "", wantState{buf: "line 1", indexOfFinalNewline: -1})
+	})
+
+	t.Run("buf has newlines", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024)
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\nline 2\nline 3")
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "line 1\nline 2\n")
+		ensureWriteResponse(t, wc, "", wantState{buf: "line 3", indexOfFinalNewline: -1})
+
+		// Writer remains usable after Flush.
+		ensureWriteResponse(t, wc, "\n", wantState{buf: "line 3\n", n: 1, indexOfFinalNewline: 6})
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3\n")
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 1024)
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\nline 2")
+		ensureError(t, wc.Flush(), "short write")
+		ensureBuffer(t, output, "line")
+		ensureWriteResponse(t, wc, "", wantState{buf: " 1\nline 2", indexOfFinalNewline: 2})
+	})
+}
+
+func TestFlushAll(t *testing.T) {
+	t.Run("empty buffer", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024)
+		ensureError(t, err)
+		ensureError(t, wc.FlushAll())
+		ensureBuffer(t, output, "")
+	})
+
+	t.Run("buf has partial line", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1024)
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\nline 2")
+		ensureError(t, wc.FlushAll())
+		ensureBuffer(t, output, "line 1\nline 2")
+		ensureWriteResponse(t, wc, "", wantState{indexOfFinalNewline: -1})
+
+		// Writer remains usable after FlushAll.
+		ensureWriteResponse(t, wc, "\nline 3", wantState{buf: "\nline 3", n: 7, indexOfFinalNewline: 0})
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3")
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 1024)
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\nline 2")
+		ensureError(t, wc.FlushAll(), "short write")
+		ensureBuffer(t, output, "line")
+		ensureWriteResponse(t, wc, "", wantState{buf: " 1\nline 2", indexOfFinalNewline: 2})
+	})
+}
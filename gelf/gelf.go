@@ -0,0 +1,402 @@
+// Package gelf provides a writer that sends each line written to it as a GELF
+// 1.1 message to a Graylog compatible collector, over UDP, with chunking and
+// optional gzip compression of large messages, or over TCP, with each message
+// terminated by a NUL byte. It is designed to be the underlying io.WriteCloser
+// of a golfw.WriteCloser, which only hands it complete lines, so each message
+// is a complete line.
+//
+//     func Example() error {
+//         gw, err := gelf.New("udp", "graylog:12201", syslog.Informational, &gelf.Options{
+//             Fields:            map[string]interface{}{"service": "api"},
+//             CompressThreshold: 1024,
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(gw, 16384)
+//         if err != nil {
+//             _ = gw.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes gw.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/netsink"
+	"github.com/karrick/golfw/syslog"
+)
+
+// DefaultChunkSize is the maximum size of a UDP datagram sent when Options does
+// not specify one. It fits within the MTU of most networks.
+const DefaultChunkSize = 1420
+
+// maxChunks is the maximum number of chunks of a message allowed by GELF.
+const maxChunks = 128
+
+// chunkHeaderSize is the size of the header of each chunk: two magic bytes, an
+// eight byte message ID, a sequence number, and the number of chunks.
+const chunkHeaderSize = 12
+
+// fieldName matches the names of additional fields allowed by GELF.
+var fieldName = regexp.MustCompile(`^[\w.\-]+$`)
+
+// Options configures a Writer.
+type Options struct {
+	// Host is the host of each message. When empty, the name returned by
+	// os.Hostname is used.
+	Host string
+
+	// Fields are additional fields included in each message. An underscore
+	// is prepended to each name that does not already start with one. Values
+	// are encoded with encoding/json.
+	Fields map[string]interface{}
+
+	// ParseLevel, when not nil, is invoked with each line to determine its
+	// level. When it returns false, the level of the Writer is used. The
+	// returned message is sent in place of the line, allowing the function
+	// to strip a prefix from the line. See syslog.PrefixSeverity.
+	ParseLevel func(line []byte) (syslog.Severity, []byte, bool)
+
+	// ChunkSize is the maximum size of each UDP datagram. Larger messages are
+	// split into chunks. Because GELF allows at most 128 chunks, the
+	// short_message of a message that would need more is truncated. When
+	// zero, DefaultChunkSize is used.
+	ChunkSize int
+
+	// CompressThreshold, when greater than zero, causes UDP messages larger
+	// than this number of bytes to be compressed with gzip before being
+	// chunked. Messages sent over TCP are never compressed.
+	CompressThreshold int
+
+	// TCP configures the reconnecting connection used for the "tcp" network.
+	TCP *netsink.Options
+
+	// Delimiter is the record delimiter of the chunks written to the Writer.
+	// When empty, LF is used.
+	Delimiter []byte
+}
+
+// Writer is an io.WriteCloser that sends each line written to it as a GELF
+// message. Empty lines are not sent, because GELF requires a non-empty
+// short_message. Its methods are safe to invoke from multiple goroutines.
+type Writer struct {
+	lock    sync.Mutex
+	level   syslog.Severity
+	options Options
+	prefix  []byte // `{"version":"1.1","host":"...",` preceding each short_message
+	suffix  []byte // additional fields following each level
+	udp     net.Conn
+	tcp     *netsink.Conn
+	buf     []byte // reused for formatting messages
+	zbuf    bytes.Buffer
+	zw      *gzip.Writer
+	chunk   []byte // reused for each chunk datagram
+	trunc   []byte // reused for truncating lines too large to send over UDP
+	closed  bool
+	now     func() time.Time
+}
+
+// New returns a Writer that sends messages with the specified level to the
+// collector at address. The network is "udp", "udp4", "udp6", or "tcp". When
+// options is nil, the defaults described by Options are used.
+func New(network, address string, level syslog.Severity, options *Options) (*Writer, error) {
+	if level < syslog.Emergency || level > syslog.Debug {
+		return nil, fmt.Errorf("cannot create Writer with invalid level: %d", level)
+	}
+	w := &Writer{level: level, now: time.Now}
+	if options != nil {
+		w.options = *options
+	}
+	if w.options.Host == "" {
+		w.options.Host, _ = os.Hostname()
+	}
+	if w.options.ChunkSize == 0 {
+		w.options.ChunkSize = DefaultChunkSize
+	}
+	if w.options.ChunkSize <= chunkHeaderSize {
+		return nil, fmt.Errorf("cannot create Writer when ChunkSize less than or equal to %d: %d", chunkHeaderSize, w.options.ChunkSize)
+	}
+	if len(w.options.Delimiter) == 0 {
+		w.options.Delimiter = []byte{'\n'}
+	}
+
+	w.prefix = append(w.prefix, `{"version":"1.1","host":`...)
+	w.prefix = appendString(w.prefix, w.options.Host)
+	w.prefix = append(w.prefix, `,"short_message":`...)
+
+	names := make([]string, 0, len(w.options.Fields))
+	for name := range w.options.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := json.Marshal(w.options.Fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode field %q: %w", name, err)
+		}
+		if name[0] != '_' {
+			name = "_" + name
+		}
+		if !fieldName.MatchString(name) || name == "_id" {
+			return nil, fmt.Errorf("cannot create Writer with invalid field name: %q", name)
+		}
+		w.suffix = append(w.suffix, ',')
+		w.suffix = appendString(w.suffix, name)
+		w.suffix = append(w.suffix, ':')
+		w.suffix = append(w.suffix, value...)
+	}
+	w.suffix = append(w.suffix, '}')
+
+	var err error
+	switch network {
+	case "udp", "udp4", "udp6":
+		w.udp, err = net.Dial(network, address)
+	case "tcp":
+		w.tcp, err = netsink.New(network, address, w.options.TCP)
+	default:
+		err = fmt.Errorf("cannot create Writer with unsupported network: %q", network)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// appendString appends s to buf as a JSON string.
+func appendString(buf []byte, s string) []byte {
+	return appendJSONString(buf, []byte(s))
+}
+
+// appendJSONString appends s to buf as a JSON string, replacing invalid UTF-8
+// with the Unicode replacement character.
+func appendJSONString(buf, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\':
+				buf = append(buf, '\\', b)
+			case b == '\n':
+				buf = append(buf, '\\', 'n')
+			case b == '\r':
+				buf = append(buf, '\\', 'r')
+			case b == '\t':
+				buf = append(buf, '\\', 't')
+			case b < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+			default:
+				buf = append(buf, b)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
+
+// appendMessage appends the GELF message for line to w.buf.
+func (w *Writer) appendMessage(line []byte, now time.Time) {
+	level := w.level
+	if w.options.ParseLevel != nil {
+		if l, msg, ok := w.options.ParseLevel(line); ok && l >= syslog.Emergency && l <= syslog.Debug {
+			level, line = l, msg
+		}
+	}
+	w.buf = append(w.buf, w.prefix...)
+	w.buf = appendJSONString(w.buf, line)
+	w.buf = append(w.buf, `,"timestamp":`...)
+	w.buf = strconv.AppendInt(w.buf, now.Unix(), 10)
+	ms := now.Nanosecond() / int(time.Millisecond)
+	w.buf = append(w.buf, '.', byte('0'+ms/100), byte('0'+ms/10%10), byte('0'+ms%10))
+	w.buf = append(w.buf, `,"level":`...)
+	w.buf = strconv.AppendInt(w.buf, int64(level), 10)
+	w.buf = append(w.buf, w.suffix...)
+}
+
+// Write sends each non-empty line of p as a GELF message. Final bytes of p
+// without a trailing delimiter are sent as a message. Messages sent over UDP
+// are sent one message at a time, and when sending fails, the returned count
+// includes only the bytes of the lines whose messages were sent. Messages sent
+// over TCP are handed to a reconnecting connection with a single write. See
+// netsink.Conn.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	now := w.now()
+	w.buf = w.buf[:0]
+	var sent int // bytes of p whose messages were sent
+	err := golfw.EachLine(p, w.options.Delimiter, func(line, raw []byte) error {
+		if len(line) == 0 {
+			sent += len(raw)
+			return nil
+		}
+		if w.tcp != nil {
+			w.appendMessage(line, now)
+			w.buf = append(w.buf, 0)
+			return nil
+		}
+		if err := w.sendLine(line, now); err != nil {
+			return err
+		}
+		sent += len(raw)
+		w.buf = w.buf[:0]
+		return nil
+	})
+	if err != nil {
+		return sent, err
+	}
+	if w.tcp != nil && len(w.buf) > 0 {
+		if _, err := w.tcp.Write(w.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// sendDatagram sends msg over UDP, splitting it into chunks when it exceeds
+// the chunk size.
+func (w *Writer) sendDatagram(msg []byte) error {
+	if len(msg) <= w.options.ChunkSize {
+		_, err := w.udp.Write(msg)
+		return err
+	}
+
+	size := w.options.ChunkSize - chunkHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > maxChunks {
+		return fmt.Errorf("cannot send message of %d bytes in more than %d chunks", len(msg), maxChunks)
+	}
+	id := rand.Uint64()
+	for seq := 0; seq < count; seq++ {
+		data := msg[seq*size:]
+		if len(data) > size {
+			data = data[:size]
+		}
+		w.chunk = append(w.chunk[:0], 0x1e, 0x0f,
+			byte(id>>56), byte(id>>48), byte(id>>40), byte(id>>32),
+			byte(id>>24), byte(id>>16), byte(id>>8), byte(id),
+			byte(seq), byte(count))
+		w.chunk = append(w.chunk, data...)
+		if _, err := w.udp.Write(w.chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendLine sends the message for line over UDP. When the message would need
+// more than the 128 chunks allowed by GELF, its short_message is truncated to
+// fit, and marked as truncated, rather than failing this and every later
+// attempt to send the line.
+func (w *Writer) sendLine(line []byte, now time.Time) error {
+	limit := maxChunks * (w.options.ChunkSize - chunkHeaderSize)
+	keep := len(line)
+	for {
+		msg := line
+		if keep < len(line) {
+			w.trunc = append(w.trunc[:0], line[:keep]...)
+			w.trunc = append(w.trunc, "...[truncated "...)
+			w.trunc = strconv.AppendInt(w.trunc, int64(len(line)-keep), 10)
+			w.trunc = append(w.trunc, " bytes]"...)
+			msg = w.trunc
+		}
+		w.buf = w.buf[:0]
+		w.appendMessage(msg, now)
+		datagram, err := w.compress(w.buf)
+		if err != nil {
+			return err
+		}
+		if len(datagram) <= limit || keep == 0 {
+			return w.sendDatagram(datagram)
+		}
+		// Each byte removed from the line removes at least one byte from an
+		// uncompressed message. A compressed message shrinks roughly in
+		// proportion to the line.
+		next := keep - (len(datagram) - limit)
+		if w.options.CompressThreshold > 0 && len(w.buf) > w.options.CompressThreshold {
+			next = int(int64(keep) * int64(limit) / int64(len(datagram)))
+			if next >= keep {
+				next = keep - 1
+			}
+		}
+		if next < 0 {
+			next = 0
+		}
+		for next > 0 && !utf8.RuneStart(line[next]) {
+			next--
+		}
+		keep = next
+	}
+}
+
+// compress returns msg compressed with gzip when it is larger than the
+// compression threshold, or msg itself otherwise.
+func (w *Writer) compress(msg []byte) ([]byte, error) {
+	if w.options.CompressThreshold == 0 || len(msg) <= w.options.CompressThreshold {
+		return msg, nil
+	}
+	w.zbuf.Reset()
+	if w.zw == nil {
+		w.zw = gzip.NewWriter(&w.zbuf)
+	} else {
+		w.zw.Reset(&w.zbuf)
+	}
+	if _, err := w.zw.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := w.zw.Close(); err != nil {
+		return nil, err
+	}
+	return w.zbuf.Bytes(), nil
+}
+
+// Close closes the connection to the collector. For TCP, it first sends the
+// messages that are pending. See netsink.Conn.Close.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	if w.tcp != nil {
+		return w.tcp.Close()
+	}
+	return w.udp.Close()
+}
@@ -0,0 +1,235 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+	"github.com/karrick/golfw/syslog"
+)
+
+var testTime = time.Date(2022, 3, 5, 12, 30, 15, 123456789, time.UTC)
+
+func newUDPWriter(tb testing.TB, options *Options) (*Writer, net.PacketConn) {
+	tb.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	ensure.Error(tb, err)
+	tb.Cleanup(func() { _ = pc.Close() })
+	gw, err := New("udp", pc.LocalAddr().String(), syslog.Informational, options)
+	ensure.Error(tb, err)
+	gw.now = func() time.Time { return testTime }
+	return gw, pc
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("udp", "127.0.0.1:12201", syslog.Severity(8), nil)
+	ensure.Error(t, err, "invalid level")
+	_, err = New("ip", "127.0.0.1", syslog.Informational, nil)
+	ensure.Error(t, err, "unsupported network")
+	_, err = New("udp", "127.0.0.1:12201", syslog.Informational, &Options{ChunkSize: 12})
+	ensure.Error(t, err, "ChunkSize")
+	_, err = New("udp", "127.0.0.1:12201", syslog.Informational, &Options{Fields: map[string]interface{}{"id": 1}})
+	ensure.Error(t, err, "invalid field name")
+	_, err = New("udp", "127.0.0.1:12201", syslog.Informational, &Options{Fields: map[string]interface{}{"a b": 1}})
+	ensure.Error(t, err, "invalid field name")
+}
+
+func TestUDP(t *testing.T) {
+	gw, pc := newUDPWriter(t, &Options{
+		Host:       "host",
+		Fields:     map[string]interface{}{"service": "api", "_shard": 3},
+		ParseLevel: syslog.PrefixSeverity,
+	})
+	lf, err := golfw.NewWriteCloser(gw, 1024)
+	ensure.Error(t, err)
+
+	_, err = lf.Write([]byte("started\n\n<3>failed \"quoted\"\tok\npartial \xff"))
+	ensure.Error(t, err)
+	ensure.Error(t, lf.Close())
+
+	var got []string
+	for _, datagram := range ensure.ReadDatagrams(t, pc, 3) {
+		got = append(got, string(datagram))
+	}
+	ensure.Strings(t, got,
+		`{"version":"1.1","host":"host","short_message":"started","timestamp":1646483415.123,"level":6,"_shard":3,"_service":"api"}`,
+		`{"version":"1.1","host":"host","short_message":"failed \"quoted\"\tok","timestamp":1646483415.123,"level":3,"_shard":3,"_service":"api"}`,
+		`{"version":"1.1","host":"host","short_message":"partial �","timestamp":1646483415.123,"level":6,"_shard":3,"_service":"api"}`,
+	)
+	for _, message := range got {
+		if !json.Valid([]byte(message)) {
+			t.Errorf("invalid JSON: %s", message)
+		}
+	}
+	ensure.Error(t, gw.Close(), "closed")
+}
+
+// reassemble returns the message from its chunks, which must arrive in order.
+func reassemble(tb testing.TB, chunks [][]byte) []byte {
+	tb.Helper()
+	var msg []byte
+	for i, chunk := range chunks {
+		if chunk[0] != 0x1e || chunk[1] != 0x0f {
+			tb.Fatalf("GOT: %x; WANT: chunk magic", chunk[:2])
+		}
+		if !bytes.Equal(chunk[2:10], chunks[0][2:10]) {
+			tb.Errorf("GOT: %x; WANT: %x", chunk[2:10], chunks[0][2:10])
+		}
+		if got, want := int(chunk[10]), i; got != want {
+			tb.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := int(chunk[11]), len(chunks); got != want {
+			tb.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		msg = append(msg, chunk[chunkHeaderSize:]...)
+	}
+	return msg
+}
+
+func TestChunking(t *testing.T) {
+	line := strings.Repeat("x", 250)
+
+	t.Run("chunked", func(t *testing.T) {
+		gw, pc := newUDPWriter(t, &Options{Host: "host", ChunkSize: 112})
+		_, err := gw.Write([]byte(line + "\n"))
+		ensure.Error(t, err)
+
+		chunks := ensure.ReadDatagrams(t, pc, 1)
+		chunks = append(chunks, ensure.ReadDatagrams(t, pc, int(chunks[0][11])-1)...)
+		if got, want := len(chunks[0]), 112; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		msg := reassemble(t, chunks)
+		var m map[string]interface{}
+		ensure.Error(t, json.Unmarshal(msg, &m))
+		if got, want := m["short_message"], line; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Error(t, gw.Close())
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		gw, pc := newUDPWriter(t, &Options{Host: "host", CompressThreshold: 100})
+		_, err := gw.Write([]byte(line + "\nshort\n"))
+		ensure.Error(t, err)
+
+		datagrams := ensure.ReadDatagrams(t, pc, 2)
+		zr, err := gzip.NewReader(bytes.NewReader(datagrams[0]))
+		ensure.Error(t, err)
+		msg, err := io.ReadAll(zr)
+		ensure.Error(t, err)
+		if !bytes.Contains(msg, []byte(line)) {
+			t.Errorf("GOT: %s; WANT: %s", msg, line)
+		}
+		if got, want := datagrams[1][0], byte('{'); got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		ensure.Error(t, gw.Close())
+	})
+
+	t.Run("too many chunks truncates short message", func(t *testing.T) {
+		gw, pc := newUDPWriter(t, &Options{Host: "host", ChunkSize: 200})
+		large := strings.Repeat("0123456789", 20000)
+		n, err := gw.Write([]byte(large + "\nnext\n"))
+		ensure.Error(t, err)
+		if got, want := n, len(large)+6; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		chunks := ensure.ReadDatagrams(t, pc, 1)
+		if got, want := int(chunks[0][11]), 128; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		chunks = append(chunks, ensure.ReadDatagrams(t, pc, int(chunks[0][11])-1)...)
+		var m map[string]interface{}
+		ensure.Error(t, json.Unmarshal(reassemble(t, chunks), &m))
+		short, _ := m["short_message"].(string)
+		if !strings.HasPrefix(short, "0123456789") || !strings.HasSuffix(short, " bytes]") {
+			t.Errorf("GOT: %.40s...%s", short, short[len(short)-40:])
+		}
+
+		next := ensure.ReadDatagrams(t, pc, 1)
+		ensure.Error(t, json.Unmarshal(next[0], &m))
+		if got, want := m["short_message"], "next"; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Error(t, gw.Close())
+	})
+
+	t.Run("too many compressed chunks truncates short message", func(t *testing.T) {
+		gw, pc := newUDPWriter(t, &Options{Host: "host", ChunkSize: 64, CompressThreshold: 100})
+		var large []byte
+		for i := 0; len(large) < 200000; i++ {
+			large = strconv.AppendInt(large, int64(i*7919%100003), 36)
+		}
+		_, err := gw.Write(append(large, "\nnext\n"...))
+		ensure.Error(t, err)
+
+		chunks := ensure.ReadDatagrams(t, pc, 1)
+		chunks = append(chunks, ensure.ReadDatagrams(t, pc, int(chunks[0][11])-1)...)
+		zr, err := gzip.NewReader(bytes.NewReader(reassemble(t, chunks)))
+		ensure.Error(t, err)
+		msg, err := io.ReadAll(zr)
+		ensure.Error(t, err)
+		if !bytes.Contains(msg, []byte(" bytes]")) {
+			t.Errorf("GOT: %.80s; WANT: truncated message", msg)
+		}
+
+		next := ensure.ReadDatagrams(t, pc, 1)
+		next = append(next, ensure.ReadDatagrams(t, pc, int(next[0][11])-1)...)
+		if msg := reassemble(t, next); !bytes.Contains(msg, []byte(`"short_message":"next"`)) {
+			t.Errorf("GOT: %s; WANT: next", msg)
+		}
+		ensure.Error(t, gw.Close())
+	})
+}
+
+func TestTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ensure.Error(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		var messages []string
+		br := bufio.NewReader(conn)
+		for {
+			msg, err := br.ReadString(0)
+			if err != nil {
+				break
+			}
+			messages = append(messages, strings.TrimSuffix(msg, "\x00"))
+		}
+		received <- messages
+	}()
+
+	gw, err := New("tcp", ln.Addr().String(), syslog.Warning, &Options{Host: "host"})
+	ensure.Error(t, err)
+	gw.now = func() time.Time { return testTime }
+	_, err = gw.Write([]byte("line 1\nline 2\n"))
+	ensure.Error(t, err)
+	ensure.Error(t, gw.Close())
+
+	select {
+	case got := <-received:
+		ensure.Strings(t, got,
+			`{"version":"1.1","host":"host","short_message":"line 1","timestamp":1646483415.123,"level":4}`,
+			`{"version":"1.1","host":"host","short_message":"line 2","timestamp":1646483415.123,"level":4}`,
+		)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for collector")
+	}
+}
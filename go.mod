@@ -1,3 +1,3 @@
 module github.com/karrick/golfw
 
-go 1.16
+go 1.20
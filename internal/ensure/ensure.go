@@ -0,0 +1,101 @@
+// Package ensure provides the test assertions shared by the tests of the
+// packages of this module.
+package ensure
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Error fails the test when err is not nil and contains is empty, or when err
+// does not contain every non-empty string in contains.
+func Error(tb testing.TB, err error, contains ...string) {
+	tb.Helper()
+	if len(contains) == 0 || (len(contains) == 1 && contains[0] == "") {
+		if err != nil {
+			tb.Fatalf("GOT: %v; WANT: %v", err, contains)
+		}
+	} else if err == nil {
+		tb.Errorf("GOT: %v; WANT: %v", err, contains)
+	} else {
+		for _, stub := range contains {
+			if stub != "" && !strings.Contains(err.Error(), stub) {
+				tb.Errorf("GOT: %v; WANT: %q", err, stub)
+			}
+		}
+	}
+}
+
+// Write fails the test when writing p to w does not write all of p without
+// error.
+func Write(tb testing.TB, w io.Writer, p string) {
+	tb.Helper()
+	n, err := w.Write([]byte(p))
+	if got, want := n, len(p); got != want {
+		tb.Errorf("GOT: %v; WANT: %v", got, want)
+	}
+	Error(tb, err)
+}
+
+// File fails the test when the contents of the named file are not want.
+func File(tb testing.TB, name, want string) {
+	tb.Helper()
+	buf, err := os.ReadFile(name)
+	Error(tb, err)
+	if got := string(buf); got != want {
+		tb.Errorf("%s: GOT: %q; WANT: %q", filepath.Base(name), got, want)
+	}
+}
+
+// String fails the test when got is not want.
+func String(tb testing.TB, got, want string) {
+	tb.Helper()
+	if got != want {
+		tb.Errorf("GOT: %q; WANT: %q", got, want)
+	}
+}
+
+// Strings fails the test when got and want do not hold the same strings in
+// the same order.
+func Strings(tb testing.TB, got []string, want ...string) {
+	tb.Helper()
+	if len(got) != len(want) {
+		tb.Fatalf("GOT: %q; WANT: %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			tb.Errorf("GOT: %q; WANT: %q", got[i], want[i])
+		}
+	}
+}
+
+// ReadDatagrams returns the next count datagrams received by pc, failing the
+// test when they are not received within five seconds.
+func ReadDatagrams(tb testing.TB, pc net.PacketConn, count int) [][]byte {
+	tb.Helper()
+	var datagrams [][]byte
+	buf := make([]byte, 65536)
+	for len(datagrams) < count {
+		_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		Error(tb, err)
+		datagrams = append(datagrams, append([]byte(nil), buf[:n]...))
+	}
+	return datagrams
+}
+
+// Datagrams fails the test when the next datagrams received by pc are not
+// want.
+func Datagrams(tb testing.TB, pc net.PacketConn, want ...string) {
+	tb.Helper()
+	var got []string
+	for _, datagram := range ReadDatagrams(tb, pc, len(want)) {
+		got = append(got, string(datagram))
+	}
+	Strings(tb, got, want...)
+}
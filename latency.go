@@ -0,0 +1,73 @@
+package golfw
+
+import "time"
+
+// latencyBuckets is the number of bounded buckets in a LatencyHistogram.
+const latencyBuckets = 16
+
+var latencyBounds = [latencyBuckets]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyBounds returns the upper bounds of the buckets of a
+// LatencyHistogram, in ascending order.
+func LatencyBounds() []time.Duration {
+	bounds := latencyBounds
+	return bounds[:]
+}
+
+// LatencyHistogram is a histogram of the durations of writes to the underlying
+// io.WriteCloser of a WriteCloser, returned by its Latency method.
+type LatencyHistogram struct {
+	// Counts holds the number of writes whose duration was less than or
+	// equal to the corresponding bound returned by LatencyBounds, and greater
+	// than the previous bound. The final element holds the number of writes
+	// whose duration was greater than the largest bound.
+	Counts [latencyBuckets + 1]uint64
+
+	// Count is the total number of writes.
+	Count uint64
+
+	// Sum is the total duration of all writes.
+	Sum time.Duration
+
+	// Max is the duration of the slowest write.
+	Max time.Duration
+}
+
+// observe adds a write of the specified duration to the histogram.
+func (h *LatencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < latencyBuckets && d > latencyBounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// Latency returns a snapshot of the histogram of durations of writes to the
+// underlying io.WriteCloser.
+func (lbf *WriteCloser) Latency() LatencyHistogram {
+	lbf.lock.Lock()
+	defer lbf.lock.Unlock()
+	return lbf.latency
+}
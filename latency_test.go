@@ -0,0 +1,99 @@
+package golfw
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// delayWriter advances a fake clock by the next delay every time it is written
+// to, to simulate a sink of varying speed.
+type delayWriter struct {
+	io.Writer
+	clock  *fakeClock
+	delays []time.Duration
+}
+
+func (dw *delayWriter) Write(p []byte) (int, error) {
+	dw.clock.Advance(dw.delays[0])
+	dw.delays = dw.delays[1:]
+	return dw.Writer.Write(p)
+}
+
+func (dw *delayWriter) Close() error { return nil }
+
+func TestLatencyBounds(t *testing.T) {
+	bounds := LatencyBounds()
+	if got, want := len(bounds), latencyBuckets; got != want {
+		t.Fatalf("GOT: %v; WANT: %v", got, want)
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			t.Errorf("bounds not ascending: %v", bounds)
+		}
+	}
+	bounds[0] = 0 // modifying returned slice does not modify histogram
+	if got, want := LatencyBounds()[0], 100*time.Microsecond; got != want {
+		t.Errorf("GOT: %v; WANT: %v", got, want)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	clock := newFakeClock()
+	output := new(bytes.Buffer)
+	sink := &delayWriter{Writer: output, clock: clock, delays: []time.Duration{
+		50 * time.Microsecond,
+		100 * time.Microsecond,
+		3 * time.Millisecond,
+		time.Minute,
+	}}
+
+	type slow struct {
+		elapsed time.Duration
+		n       int
+	}
+	var slows []slow
+
+	wc, err := NewWriteCloser(sink, 1, WithClock(clock), WithSlowFlush(time.Millisecond, func(elapsed time.Duration, n int, err error) {
+		ensureError(t, err)
+		slows = append(slows, slow{elapsed, n})
+	}))
+	ensureError(t, err)
+
+	ensureWrite(t, wc, "line 1\n")
+	ensureWrite(t, wc, "line 2\n")
+	ensureWrite(t, wc, "line 3\n")
+	ensureWrite(t, wc, "final")
+	ensureError(t, wc.Close())
+	ensureBuffer(t, output, "line 1\nline 2\nline 3\nfinal")
+
+	var want LatencyHistogram
+	want.Counts[0] = 2 // 50µs and 100µs
+	want.Counts[5] = 1 // 3ms
+	want.Counts[latencyBuckets] = 1
+	want.Count = 4
+	want.Sum = 50*time.Microsecond + 100*time.Microsecond + 3*time.Millisecond + time.Minute
+	want.Max = time.Minute
+	if got := wc.Latency(); got != want {
+		t.Errorf("GOT: %+v; WANT: %+v", got, want)
+	}
+
+	if got, want := len(slows), 2; got != want {
+		t.Fatalf("GOT: %v; WANT: %v", got, want)
+	}
+	if got, want := slows[0], (slow{3 * time.Millisecond, 7}); got != want {
+		t.Errorf("GOT: %v; WANT: %v", got, want)
+	}
+	if got, want := slows[1], (slow{time.Minute, 5}); got != want {
+		t.Errorf("GOT: %v; WANT: %v", got, want)
+	}
+}
+
+func TestSlowFlushOption(t *testing.T) {
+	_, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithSlowFlush(0, func(time.Duration, int, error) {}))
+	ensureError(t, err, "slow flush threshold")
+
+	_, err = NewWriteCloser(NopCloseWriter(io.Discard), 16, WithSlowFlush(time.Second, nil))
+	ensureError(t, err, "nil slow flush callback")
+}
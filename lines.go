@@ -0,0 +1,32 @@
+package golfw
+
+import "bytes"
+
+// EachLine invokes fn for each line in p, in order, with the line excluding
+// its delimiter, and the raw bytes of the line including its delimiter. The
+// final line of p need not end with the delimiter. When fn returns an error,
+// EachLine stops and returns it.
+//
+//     var sent int
+//     err := golfw.EachLine(p, []byte("\n"), func(line, raw []byte) error {
+//         if err := send(line); err != nil {
+//             return err
+//         }
+//         sent += len(raw)
+//         return nil
+//     })
+func EachLine(p, delimiter []byte, fn func(line, raw []byte) error) error {
+	for len(p) > 0 {
+		end := len(p)
+		next := end
+		if i := bytes.Index(p, delimiter); i >= 0 {
+			end = i
+			next = i + len(delimiter)
+		}
+		if err := fn(p[:end], p[:next]); err != nil {
+			return err
+		}
+		p = p[next:]
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package golfw
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEachLine(t *testing.T) {
+	each := func(p, delimiter string, stop int) ([]string, error) {
+		var got []string
+		err := EachLine([]byte(p), []byte(delimiter), func(line, raw []byte) error {
+			if len(got) == stop {
+				return errors.New("test stop")
+			}
+			got = append(got, string(line)+"|"+string(raw))
+			return nil
+		})
+		return got, err
+	}
+	ensureLines := func(t *testing.T, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("GOT: %q; WANT: %q", got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("GOT: %q; WANT: %q", got[i], want[i])
+			}
+		}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		got, err := each("", "\n", -1)
+		ensureError(t, err)
+		ensureLines(t, got)
+	})
+
+	t.Run("final line without delimiter", func(t *testing.T) {
+		got, err := each("one\r\n\r\nthree", "\r\n", -1)
+		ensureError(t, err)
+		ensureLines(t, got, "one|one\r\n", "|\r\n", "three|three")
+	})
+
+	t.Run("stops on error", func(t *testing.T) {
+		got, err := each("one\ntwo\nthree\n", "\n", 2)
+		ensureError(t, err, "test stop")
+		ensureLines(t, got, "one|one\n", "two|two\n")
+	})
+}
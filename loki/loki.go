@@ -0,0 +1,297 @@
+// Package loki provides a writer that sends the lines written to it to Grafana
+// Loki with the push API. It is designed to be the underlying io.WriteCloser
+// of a golfw.WriteCloser, which already batches complete lines, so the flush
+// threshold of the golfw.WriteCloser determines the size of each push request.
+//
+//     func Example() error {
+//         lw, err := loki.New("http://localhost:3100", map[string]string{"app": "api"}, &loki.Options{
+//             Extract: map[string]golfw.KeyFunc{"level": golfw.LogfmtKey("level")},
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(lw, 1<<20, golfw.WithFlushInterval(time.Second))
+//         if err != nil {
+//             _ = lw.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes lw.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karrick/golfw"
+)
+
+// Defaults of the retry policy used when Options does not specify one.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultJitter         = 0.2
+)
+
+// labelName matches the label names allowed by Loki.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Options configures a Writer.
+type Options struct {
+	// Extract maps the name of each label to the KeyFunc that extracts its
+	// value from each line, for instance golfw.LogfmtKey("level"). When the
+	// KeyFunc returns nil or an empty value, the line does not have the
+	// label. An extracted label replaces a static label with the same name.
+	Extract map[string]golfw.KeyFunc
+
+	// Client is used to send push requests. When nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	// Header holds additional headers sent with each push request, for
+	// instance X-Scope-OrgID.
+	Header http.Header
+
+	// Retry determines the maximum number of attempts to send each push
+	// request, including the initial attempt, and the backoff between
+	// attempts. Only requests that fail with a retryable status, 429 or
+	// 5xx, or with a transport error, are sent again, so its Retryable field
+	// is ignored. When nil, the policy described by the Default constants
+	// is used.
+	Retry *golfw.RetryPolicy
+
+	// Delimiter is the record delimiter of the chunks written to the Writer.
+	// When empty, LF is used.
+	Delimiter []byte
+}
+
+// pushRequest is the JSON body of a push request.
+type pushRequest struct {
+	Streams []*stream `json:"streams"`
+}
+
+type stream struct {
+	Labels map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Writer is an io.WriteCloser that sends each chunk of lines written to it
+// with a single push request, grouping lines into streams by their labels.
+// Each line is given a timestamp in nanoseconds when it is written, strictly
+// greater than that of the previous line, so lines keep their order. Empty
+// lines are not sent. Its methods are safe to invoke from multiple goroutines.
+type Writer struct {
+	lock    sync.Mutex
+	url     string
+	labels  map[string]string
+	names   []string // sorted names of extracted labels
+	options Options
+	streams map[string]*stream // streams of the current chunk by label set
+	key     []byte             // reused for the label set of each line
+	values  [][]byte           // reused for the extracted values of each line
+	last    int64              // timestamp of the previous line
+	retry   golfw.RetryPolicy
+	closed  bool
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+// New returns a Writer that pushes lines to the Loki server at url, for
+// instance "http://localhost:3100", with the specified static labels. At least
+// one static label is required. When options is nil, the defaults described by
+// Options are used.
+func New(url string, labels map[string]string, options *Options) (*Writer, error) {
+	if len(labels) == 0 {
+		return nil, errors.New("cannot create Writer without labels")
+	}
+	w := &Writer{
+		url:     strings.TrimSuffix(url, "/") + "/loki/api/v1/push",
+		labels:  make(map[string]string, len(labels)),
+		streams: make(map[string]*stream),
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+	for name, value := range labels {
+		if !labelName.MatchString(name) {
+			return nil, fmt.Errorf("cannot create Writer with invalid label name: %q", name)
+		}
+		w.labels[name] = value
+	}
+	if options != nil {
+		w.options = *options
+	}
+	for name, extract := range w.options.Extract {
+		if !labelName.MatchString(name) {
+			return nil, fmt.Errorf("cannot create Writer with invalid label name: %q", name)
+		}
+		if extract == nil {
+			return nil, fmt.Errorf("cannot create Writer when label %q has nil KeyFunc", name)
+		}
+		w.names = append(w.names, name)
+	}
+	sort.Strings(w.names)
+	w.retry = golfw.RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Jitter:         DefaultJitter,
+	}
+	if w.options.Retry != nil {
+		w.retry = *w.options.Retry
+	}
+	if err := w.retry.Validate(); err != nil {
+		return nil, fmt.Errorf("cannot create Writer: %w", err)
+	}
+	if w.options.Client == nil {
+		w.options.Client = http.DefaultClient
+	}
+	if len(w.options.Delimiter) == 0 {
+		w.options.Delimiter = []byte{'\n'}
+	}
+	return w, nil
+}
+
+// stream returns the stream for the labels of line, creating it when the
+// current chunk does not yet have a stream for those labels.
+func (w *Writer) stream(line []byte) *stream {
+	// The key is the extracted values, each preceded by its length, which
+	// identifies the label set without allocating.
+	w.key = w.key[:0]
+	w.values = w.values[:0]
+	for _, name := range w.names {
+		value := w.options.Extract[name](line)
+		w.key = strconv.AppendInt(w.key, int64(len(value)), 10)
+		w.key = append(w.key, ':')
+		w.key = append(w.key, value...)
+		w.values = append(w.values, value)
+	}
+	if s, ok := w.streams[string(w.key)]; ok {
+		return s
+	}
+	s := &stream{Labels: make(map[string]string, len(w.labels)+len(w.names))}
+	for name, value := range w.labels {
+		s.Labels[name] = value
+	}
+	for i, name := range w.names {
+		if len(w.values[i]) > 0 {
+			s.Labels[name] = string(w.values[i])
+		}
+	}
+	w.streams[string(w.key)] = s
+	return s
+}
+
+// Write sends the non-empty lines of p with a single push request. Final bytes
+// of p without a trailing delimiter are sent as a line. When the request fails
+// with a retryable status, it is sent again, as allowed by the retry policy.
+// Because Loki accepts or rejects the entire request, Write returns 0 along
+// with the error when the request is not accepted.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	for key := range w.streams {
+		delete(w.streams, key)
+	}
+	ts := w.now().UnixNano()
+	_ = golfw.EachLine(p, w.options.Delimiter, func(line, _ []byte) error {
+		if len(line) > 0 {
+			if ts <= w.last {
+				ts = w.last + 1
+			}
+			w.last = ts
+			s := w.stream(line)
+			s.Values = append(s.Values, [2]string{strconv.FormatInt(ts, 10), string(line)})
+		}
+		return nil
+	})
+	if len(w.streams) == 0 {
+		return len(p), nil
+	}
+
+	var req pushRequest
+	keys := make([]string, 0, len(w.streams))
+	for key := range w.streams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // deterministic order of streams
+	for _, key := range keys {
+		req.Streams = append(req.Streams, w.streams[key])
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := w.push(body)
+		if err == nil {
+			return len(p), nil
+		}
+		if !retry || attempt >= w.retry.MaxAttempts {
+			return 0, err
+		}
+		w.sleep(w.retry.Backoff(attempt))
+	}
+}
+
+// push sends a push request with body, and returns an error when it is not
+// accepted, along with whether it may be accepted when sent again.
+func (w *Writer) push(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for key, values := range w.options.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.options.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("cannot push: status %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+}
+
+// Close causes subsequent writes to fail. It does not close the idle
+// connections of the HTTP client, which may be shared.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,164 @@
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+// fakeLoki is an http.Handler that stands in for the push API, decoding and
+// recording the body of each push request.
+type fakeLoki struct {
+	lock     sync.Mutex
+	requests []pushRequest
+	orgIDs   []string
+	statuses []int // status of each response, then 204
+}
+
+func (fl *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fl.lock.Lock()
+	defer fl.lock.Unlock()
+
+	if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var req pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fl.requests = append(fl.requests, req)
+	fl.orgIDs = append(fl.orgIDs, r.Header.Get("X-Scope-OrgID"))
+	if len(fl.statuses) > 0 {
+		status := fl.statuses[0]
+		fl.statuses = fl.statuses[1:]
+		http.Error(w, "try again", status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var testTime = time.Date(2022, 3, 5, 12, 30, 15, 0, time.UTC)
+
+func newTestWriter(tb testing.TB, options *Options) (*Writer, *fakeLoki) {
+	tb.Helper()
+	fl := new(fakeLoki)
+	server := httptest.NewServer(fl)
+	tb.Cleanup(server.Close)
+	lw, err := New(server.URL, map[string]string{"app": "api", "level": "unknown"}, options)
+	ensure.Error(tb, err)
+	lw.now = func() time.Time { return testTime }
+	return lw, fl
+}
+
+// format returns a compact representation of the streams of req.
+func format(req pushRequest) string {
+	var streams []string
+	for _, s := range req.Streams {
+		var values []string
+		for _, v := range s.Values {
+			values = append(values, v[0]+" "+v[1])
+		}
+		streams = append(streams, fmt.Sprintf("%v %q", s.Labels, values))
+	}
+	return strings.Join(streams, "\n")
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("http://localhost:3100", nil, nil)
+	ensure.Error(t, err, "without labels")
+	_, err = New("http://localhost:3100", map[string]string{"bad-name": "x"}, nil)
+	ensure.Error(t, err, "invalid label name")
+	_, err = New("http://localhost:3100", map[string]string{"app": "x"}, &Options{Extract: map[string]golfw.KeyFunc{"level": nil}})
+	ensure.Error(t, err, "nil KeyFunc")
+	_, err = New("http://localhost:3100", map[string]string{"app": "x"}, &Options{Retry: &golfw.RetryPolicy{}})
+	ensure.Error(t, err, "max attempts")
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("groups lines into streams", func(t *testing.T) {
+		lw, fl := newTestWriter(t, &Options{
+			Extract: map[string]golfw.KeyFunc{"level": golfw.LogfmtKey("level")},
+			Header:  http.Header{"X-Scope-OrgID": {"tenant-1"}},
+		})
+		lf, err := golfw.NewWriteCloser(lw, 1024)
+		ensure.Error(t, err)
+
+		_, err = lf.Write([]byte("level=info a\nlevel=error b\n\nno level\nlevel=info c"))
+		ensure.Error(t, err)
+		ensure.Error(t, lf.Close())
+
+		if got, want := len(fl.requests), 1; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", got, want)
+		}
+		ns := testTime.UnixNano()
+		want := strings.Join([]string{
+			fmt.Sprintf(`map[app:api level:unknown] ["%d no level"]`, ns+2),
+			fmt.Sprintf(`map[app:api level:info] ["%d level=info a" "%d level=info c"]`, ns, ns+3),
+			fmt.Sprintf(`map[app:api level:error] ["%d level=error b"]`, ns+1),
+		}, "\n")
+		if got := format(fl.requests[0]); got != want {
+			t.Errorf("GOT:\n%s\nWANT:\n%s", got, want)
+		}
+		if got, want := fl.orgIDs[0], "tenant-1"; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Error(t, lw.Close(), "closed")
+	})
+
+	t.Run("timestamps increase across writes", func(t *testing.T) {
+		lw, fl := newTestWriter(t, nil)
+
+		_, err := lw.Write([]byte("a\nb\n"))
+		ensure.Error(t, err)
+		_, err = lw.Write([]byte("c\n"))
+		ensure.Error(t, err)
+
+		ns := testTime.UnixNano()
+		if got, want := format(fl.requests[1]), fmt.Sprintf(`map[app:api level:unknown] ["%d c"]`, ns+2); got != want {
+			t.Errorf("GOT: %s; WANT: %s", got, want)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		lw, fl := newTestWriter(t, &Options{Retry: &golfw.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second}})
+		var sleeps []time.Duration
+		lw.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+		fl.statuses = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+		n, err := lw.Write([]byte("a\n"))
+		ensure.Error(t, err)
+		if got, want := n, 2; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := len(fl.requests), 3; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := fmt.Sprint(sleeps), "[1s 2s]"; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("does not retry rejected request", func(t *testing.T) {
+		lw, fl := newTestWriter(t, nil)
+		fl.statuses = []int{http.StatusBadRequest}
+
+		n, err := lw.Write([]byte("a\n"))
+		ensure.Error(t, err, "cannot push: status 400: try again")
+		if got, want := n, 0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := len(fl.requests), 1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package golfw
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// LongLinePolicy determines how a WriteCloser handles lines longer than the
+// maximum line length configured by WithMaxLineLength.
+type LongLinePolicy int
+
+const (
+	// SplitLongLines emits the first maximum line length bytes of a long
+	// line, followed by the continuation marker and the delimiter, then
+	// treats the remaining bytes as the start of a new line.
+	SplitLongLines LongLinePolicy = iota
+
+	// TruncateLongLines discards the bytes of a long line beyond the maximum
+	// line length, and emits the line with a "...[truncated N bytes]" suffix
+	// prior to its delimiter.
+	TruncateLongLines
+
+	// RejectLongLines causes Write to accept bytes of a long line only up to
+	// the maximum line length, and return a *LineTooLongError.
+	RejectLongLines
+)
+
+// DefaultContinuationMarker is emitted at the end of each but the final
+// segment of a split line, prior to the delimiter, unless a different marker
+// is configured by WithContinuationMarker.
+const DefaultContinuationMarker = `\`
+
+// LineTooLongError is returned by Write when a line would exceed the maximum
+// line length and the RejectLongLines policy is configured.
+type LineTooLongError struct {
+	MaxLineLength int
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("cannot write line longer than %d bytes", e.MaxLineLength)
+}
+
+// writeLimited rewrites the bytes in buffer after the final delimiter that
+// preceded this write, so that no line exceeds the maximum line length, then
+// flushes when the buffer exceeds the flush threshold. Because the bytes from
+// p are rewritten, they are retained in the buffer when the flush fails, and
+// are reported as written.
+func (lbf *WriteCloser) writeLimited(olen, dlen int) (int, error) {
+	lineStart := lbf.indexOfFinalNewline + 1
+	n, err := lbf.limitLines(lineStart, olen, dlen)
+
+	if finalIndex := lbf.lastDelimiter(lineStart); finalIndex >= 0 {
+		lbf.indexOfFinalNewline = finalIndex
+	}
+
+	if err != nil || len(lbf.buf) <= lbf.flushThreshold || lbf.indexOfFinalNewline < 0 {
+		lbf.armFlushTimer()
+		return n, err
+	}
+
+	err = lbf.flushLines()
+	lbf.armFlushTimer()
+	return n, err
+}
+
+// limitLines rewrites the bytes in buffer starting at lineStart so that no line
+// exceeds the maximum line length. It returns the number of bytes of p that
+// were accepted, which is only less than dlen for the RejectLongLines policy.
+func (lbf *WriteCloser) limitLines(lineStart, olen, dlen int) (int, error) {
+	lbf.scratch = append(lbf.scratch[:0], lbf.buf[lineStart:]...)
+	lbf.buf = lbf.buf[:lineStart]
+
+	max := lbf.maxLineLength
+	tail := lbf.scratch
+	var offset int // index in scratch of start of tail
+
+	for {
+		i := bytes.Index(tail, lbf.delimiter)
+		if i < 0 {
+			break
+		}
+		line := tail[:i]
+		if len(line) > max || lbf.truncated > 0 {
+			switch lbf.longLinePolicy {
+			case SplitLongLines:
+				line = lbf.appendSplit(line)
+			case TruncateLongLines:
+				line = lbf.appendTruncated(line, 0)
+			case RejectLongLines:
+				lbf.buf = append(lbf.buf, line[:max]...)
+				return lbf.accepted(offset+max, lineStart, olen, dlen), &LineTooLongError{MaxLineLength: max}
+			}
+		}
+		lbf.buf = append(lbf.buf, line...)
+		if lbf.truncated > 0 {
+			lbf.buf = appendTruncationSuffix(lbf.buf, lbf.truncated)
+			lbf.truncated = 0
+		}
+		lbf.buf = append(lbf.buf, lbf.delimiter...)
+		tail = tail[i+len(lbf.delimiter):]
+		offset += i + len(lbf.delimiter)
+	}
+
+	// The final partial line may end with the initial bytes of a multiple
+	// byte delimiter, which must be retained so the delimiter can be found
+	// when its remaining bytes are written.
+	k := partialDelimiter(tail, lbf.delimiter)
+	if len(tail)-k > max {
+		switch lbf.longLinePolicy {
+		case SplitLongLines:
+			tail = lbf.appendSplit(tail)
+		case TruncateLongLines:
+			tail = lbf.appendTruncated(tail, k)
+		case RejectLongLines:
+			lbf.buf = append(lbf.buf, tail[:max]...)
+			return lbf.accepted(offset+max, lineStart, olen, dlen), &LineTooLongError{MaxLineLength: max}
+		}
+	}
+	lbf.buf = append(lbf.buf, tail...)
+	return dlen, nil
+}
+
+// accepted returns the number of bytes of p that were accepted when the byte
+// at index in scratch was the first byte rejected.
+func (lbf *WriteCloser) accepted(index, lineStart, olen, dlen int) int {
+	n := index - (olen - lineStart)
+	if n < 0 {
+		return 0
+	}
+	if n > dlen {
+		return dlen
+	}
+	return n
+}
+
+// appendSplit appends segments of maximum line length bytes from line, each
+// followed by the continuation marker and the delimiter, to buffer, and returns
+// the remaining bytes of line.
+func (lbf *WriteCloser) appendSplit(line []byte) []byte {
+	for len(line) > lbf.maxLineLength {
+		lbf.buf = append(lbf.buf, line[:lbf.maxLineLength]...)
+		lbf.buf = append(lbf.buf, lbf.continuationMarker...)
+		lbf.buf = append(lbf.buf, lbf.delimiter...)
+		line = line[lbf.maxLineLength:]
+	}
+	return line
+}
+
+// appendTruncated appends maximum line length bytes of line to buffer, and
+// returns the final keep bytes of line, which are retained because they may be
+// the initial bytes of a multiple byte delimiter. The number of discarded bytes
+// is accumulated until the line is terminated.
+func (lbf *WriteCloser) appendTruncated(line []byte, keep int) []byte {
+	if discard := len(line) - keep - lbf.maxLineLength; discard > 0 {
+		lbf.truncated += discard
+		lbf.buf = append(lbf.buf, line[:lbf.maxLineLength]...)
+		return line[len(line)-keep:]
+	}
+	return line
+}
+
+// appendTruncationSuffix appends the suffix that marks a truncated line to buf.
+func appendTruncationSuffix(buf []byte, truncated int) []byte {
+	buf = append(buf, "...[truncated "...)
+	buf = strconv.AppendInt(buf, int64(truncated), 10)
+	return append(buf, " bytes]"...)
+}
+
+// partialDelimiter returns the length of the longest suffix of buf that is a
+// proper prefix of delimiter.
+func partialDelimiter(buf, delimiter []byte) int {
+	for k := len(delimiter) - 1; k > 0; k-- {
+		if bytes.HasSuffix(buf, delimiter[:k]) {
+			return k
+		}
+	}
+	return 0
+}
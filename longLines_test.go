@@ -0,0 +1,218 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMaxLineLength(t *testing.T) {
+	t.Run("option", func(t *testing.T) {
+		_, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithMaxLineLength(0, SplitLongLines))
+		ensureError(t, err, "maximum line length")
+
+		_, err = NewWriteCloser(NopCloseWriter(io.Discard), 16, WithMaxLineLength(8, LongLinePolicy(42)))
+		ensureError(t, err, "unknown long line policy")
+	})
+
+	t.Run("short lines unchanged", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 8, WithMaxLineLength(8, TruncateLongLines))
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1", wantState{
+			buf:                 "line 1",
+			n:                   6,
+			indexOfFinalNewline: -1,
+		})
+		ensureWriteResponse(t, wc, "\nline 2", wantState{
+			buf:                 "line 2",
+			n:                   7,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "line 1\n")
+	})
+
+	t.Run("split", func(t *testing.T) {
+		t.Run("complete line", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, SplitLongLines))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "abcdefghij\nxy\n", wantState{
+				buf:                 "abcd\\\nefgh\\\nij\nxy\n",
+				n:                   14,
+				indexOfFinalNewline: 17,
+			})
+		})
+
+		t.Run("partial line across writes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, SplitLongLines), WithContinuationMarker([]byte(" +")))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "abc", wantState{
+				buf:                 "abc",
+				n:                   3,
+				indexOfFinalNewline: -1,
+			})
+			ensureWriteResponse(t, wc, "defgh", wantState{
+				buf:                 "abcd +\nefgh",
+				n:                   5,
+				indexOfFinalNewline: 6,
+			})
+			ensureWriteResponse(t, wc, "i", wantState{
+				buf:                 "abcd +\nefgh +\ni",
+				n:                   1,
+				indexOfFinalNewline: 13,
+			})
+			ensureError(t, wc.Close())
+			ensureBuffer(t, output, "abcd +\nefgh +\ni")
+		})
+
+		t.Run("flushes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 4, WithMaxLineLength(4, SplitLongLines))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "abcdefghij", wantState{
+				buf:                 "ij",
+				n:                   10,
+				indexOfFinalNewline: -1,
+			})
+			ensureBuffer(t, output, "abcd\\\nefgh\\\n")
+		})
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		t.Run("complete line", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, TruncateLongLines))
+			ensureError(t, err)
+
+			ensureWrite(t, wc, "abcdefghij\nxy\n")
+			ensureError(t, wc.Flush())
+			ensureBuffer(t, output, "abcd...[truncated 6 bytes]\nxy\n")
+		})
+
+		t.Run("partial line across writes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, TruncateLongLines))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "abcdef", wantState{
+				buf:                 "abcd",
+				n:                   6,
+				indexOfFinalNewline: -1,
+			})
+			ensureWriteResponse(t, wc, "ghi", wantState{
+				buf:                 "abcd",
+				n:                   3,
+				indexOfFinalNewline: -1,
+			})
+			ensureWriteResponse(t, wc, "\nxy", wantState{
+				buf:                 "abcd...[truncated 5 bytes]\nxy",
+				n:                   3,
+				indexOfFinalNewline: 26,
+			})
+		})
+
+		t.Run("partial line at close", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, TruncateLongLines))
+			ensureError(t, err)
+
+			ensureWrite(t, wc, "abcdef")
+			ensureError(t, wc.Close())
+			ensureBuffer(t, output, "abcd...[truncated 2 bytes]")
+		})
+
+		t.Run("partial line at flush all", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, TruncateLongLines))
+			ensureError(t, err)
+
+			ensureWrite(t, wc, "abcdef")
+			ensureError(t, wc.FlushAll())
+			ensureWrite(t, wc, "gh\n")
+			ensureError(t, wc.Close())
+			ensureBuffer(t, output, "abcd...[truncated 2 bytes]gh\n")
+		})
+
+		t.Run("multiple byte delimiter split across writes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, TruncateLongLines), WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+
+			ensureWriteResponse(t, wc, "abcdef\r", wantState{
+				buf:                 "abcd\r",
+				n:                   7,
+				indexOfFinalNewline: -1,
+			})
+			ensureWriteResponse(t, wc, "\nxy", wantState{
+				buf:                 "abcd...[truncated 2 bytes]\r\nxy",
+				n:                   3,
+				indexOfFinalNewline: 27,
+			})
+		})
+
+		t.Run("partial delimiter later discarded", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, TruncateLongLines), WithDelimiter([]byte("\r\n")))
+			ensureError(t, err)
+
+			ensureWrite(t, wc, "abcdef\r")
+			ensureWrite(t, wc, "g\r\n")
+			ensureError(t, wc.Flush())
+			ensureBuffer(t, output, "abcd...[truncated 4 bytes]\r\n")
+		})
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		t.Run("complete line", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, RejectLongLines))
+			ensureError(t, err)
+
+			n, err := wc.Write([]byte("xy\nabcdefghij\n"))
+			if got, want := n, 7; got != want {
+				t.Errorf("GOT: %v; WANT: %v", got, want)
+			}
+			var lineTooLong *LineTooLongError
+			if !errors.As(err, &lineTooLong) {
+				t.Fatalf("GOT: %v; WANT: %T", err, lineTooLong)
+			}
+			if got, want := lineTooLong.MaxLineLength, 4; got != want {
+				t.Errorf("GOT: %v; WANT: %v", got, want)
+			}
+			if got, want := string(wc.buf), "xy\nabcd"; got != want {
+				t.Errorf("GOT: %q; WANT: %q", got, want)
+			}
+			if got, want := wc.indexOfFinalNewline, 2; got != want {
+				t.Errorf("GOT: %v; WANT: %v", got, want)
+			}
+
+			// Writer accepts a delimiter to terminate the line.
+			ensureWrite(t, wc, "\n")
+			ensureError(t, wc.Close())
+			ensureBuffer(t, output, "xy\nabcd\n")
+		})
+
+		t.Run("partial line across writes", func(t *testing.T) {
+			output := new(bytes.Buffer)
+			wc, err := NewWriteCloser(NopCloseWriter(output), 1024, WithMaxLineLength(4, RejectLongLines))
+			ensureError(t, err)
+
+			ensureWrite(t, wc, "abc")
+			n, err := wc.Write([]byte("def"))
+			ensureError(t, err, "longer than 4 bytes")
+			if got, want := n, 1; got != want {
+				t.Errorf("GOT: %v; WANT: %v", got, want)
+			}
+			if got, want := string(wc.buf), "abcd"; got != want {
+				t.Errorf("GOT: %q; WANT: %q", got, want)
+			}
+		})
+	})
+}
@@ -0,0 +1,197 @@
+// Package metrics exports the counters of one or more golfw.WriteCloser
+// instances in the Prometheus text exposition format, and through the expvar
+// package, without depending on a metrics client library.
+//
+//     func Example(lf *golfw.WriteCloser) error {
+//         registry := metrics.NewRegistry()
+//         if err := registry.Register("access", lf); err != nil {
+//             return err
+//         }
+//         registry.Publish("golfw") // expvar, served at /debug/vars
+//         http.Handle("/metrics", registry)
+//         return http.ListenAndServe(":8080", nil)
+//     }
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/karrick/golfw"
+)
+
+// StatsProvider is implemented by golfw.WriteCloser.
+type StatsProvider interface {
+	Stats() golfw.Stats
+}
+
+// LatencyProvider is implemented by golfw.WriteCloser. When a registered
+// StatsProvider also implements LatencyProvider, its histogram of write
+// durations is exported as well.
+type LatencyProvider interface {
+	Latency() golfw.LatencyHistogram
+}
+
+// Registry is a set of named StatsProvider instances. It implements
+// http.Handler, serving their counters in the Prometheus text exposition
+// format. Its methods are safe to invoke from multiple goroutines.
+type Registry struct {
+	lock    sync.RWMutex
+	writers map[string]StatsProvider
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{writers: make(map[string]StatsProvider)}
+}
+
+// Register adds the StatsProvider to the Registry with the specified name,
+// which is used as the value of the writer label of each metric. It returns an
+// error when the name is already registered.
+func (r *Registry) Register(name string, sp StatsProvider) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.writers[name]; ok {
+		return fmt.Errorf("cannot register duplicate writer name: %q", name)
+	}
+	r.writers[name] = sp
+	return nil
+}
+
+// Unregister removes the StatsProvider with the specified name from the
+// Registry.
+func (r *Registry) Unregister(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.writers, name)
+}
+
+// snapshot returns the registered names in sorted order, the Stats of each,
+// and the LatencyHistogram of each that implements LatencyProvider.
+func (r *Registry) snapshot() ([]string, map[string]golfw.Stats, map[string]golfw.LatencyHistogram) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.writers))
+	stats := make(map[string]golfw.Stats, len(r.writers))
+	latencies := make(map[string]golfw.LatencyHistogram, len(r.writers))
+	for name, sp := range r.writers {
+		names = append(names, name)
+		stats[name] = sp.Stats()
+		if lp, ok := sp.(LatencyProvider); ok {
+			latencies[name] = lp.Latency()
+		}
+	}
+	sort.Strings(names)
+	return names, stats, latencies
+}
+
+// metric describes how to render one field of golfw.Stats.
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(golfw.Stats) uint64
+}
+
+var descriptors = []metric{
+	{"golfw_lines_written_total", "counter", "Lines written to the underlying writer.", func(s golfw.Stats) uint64 { return s.LinesWritten }},
+	{"golfw_bytes_in_total", "counter", "Bytes accepted by Write.", func(s golfw.Stats) uint64 { return s.BytesIn }},
+	{"golfw_bytes_flushed_total", "counter", "Bytes written to the underlying writer.", func(s golfw.Stats) uint64 { return s.BytesFlushed }},
+	{"golfw_flushes_total", "counter", "Writes to the underlying writer.", func(s golfw.Stats) uint64 { return s.Flushes }},
+	{"golfw_sink_errors_total", "counter", "Errors returned by the underlying writer.", func(s golfw.Stats) uint64 { return s.SinkErrors }},
+	{"golfw_partial_lines_at_close_total", "counter", "Final lines without a delimiter written by Close.", func(s golfw.Stats) uint64 { return s.PartialLinesAtClose }},
+	{"golfw_dropped_chunks_total", "counter", "Chunks of lines discarded because the queue was full.", func(s golfw.Stats) uint64 { return s.Dropped }},
+	{"golfw_spooled_bytes_total", "counter", "Bytes appended to the spool.", func(s golfw.Stats) uint64 { return s.Spooled }},
+	{"golfw_buffered_bytes", "gauge", "Bytes currently buffered.", func(s golfw.Stats) uint64 { return uint64(s.Buffered) }},
+	{"golfw_peak_buffered_bytes", "gauge", "Largest number of bytes buffered.", func(s golfw.Stats) uint64 { return uint64(s.PeakBuffered) }},
+	{"golfw_spool_bytes", "gauge", "Bytes currently in the spool.", func(s golfw.Stats) uint64 { return uint64(s.SpoolBytes) }},
+}
+
+// WritePrometheus writes the counters of every registered StatsProvider to w
+// in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	names, stats, latencies := r.snapshot()
+	bw := bufio.NewWriter(w)
+	for _, m := range descriptors {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s{writer=\"%s\"} %d\n", m.name, escapeLabelValue(name), m.value(stats[name]))
+		}
+	}
+	if len(latencies) > 0 {
+		writeLatencies(bw, names, latencies)
+	}
+	return bw.Flush()
+}
+
+// writeLatencies writes the latency histograms in the Prometheus text
+// exposition format.
+func writeLatencies(bw *bufio.Writer, names []string, latencies map[string]golfw.LatencyHistogram) {
+	const name = "golfw_sink_write_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Duration of writes to the underlying writer.\n# TYPE %s histogram\n", name, name)
+	bounds := golfw.LatencyBounds()
+	for _, writer := range names {
+		h, ok := latencies[writer]
+		if !ok {
+			continue
+		}
+		label := escapeLabelValue(writer)
+		var cumulative uint64
+		for i, bound := range bounds {
+			cumulative += h.Counts[i]
+			fmt.Fprintf(bw, "%s_bucket{writer=\"%s\",le=\"%s\"} %d\n", name, label, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(bw, "%s_bucket{writer=\"%s\",le=\"+Inf\"} %d\n", name, label, h.Count)
+		fmt.Fprintf(bw, "%s_sum{writer=\"%s\"} %s\n", name, label, strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(bw, "%s_count{writer=\"%s\"} %d\n", name, label, h.Count)
+	}
+}
+
+// labelValueEscaper escapes label values as required by the Prometheus text
+// exposition format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
+
+// ServeHTTP serves the counters of every registered StatsProvider in the
+// Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WritePrometheus(w) // nothing to be done when client goes away
+}
+
+// publishLock serializes checking whether a name is published with the expvar
+// package with publishing it.
+var publishLock sync.Mutex
+
+// Publish publishes the Registry with the expvar package under the specified
+// name, as an object mapping each registered name to its golfw.Stats. Like
+// expvar.Publish, it panics when the name is already published. See
+// TryPublish.
+func (r *Registry) Publish(name string) {
+	if err := r.TryPublish(name); err != nil {
+		panic(err)
+	}
+}
+
+// TryPublish is like Publish, but returns an error rather than panicking when
+// the name is already published with the expvar package.
+func (r *Registry) TryPublish(name string) error {
+	publishLock.Lock()
+	defer publishLock.Unlock()
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("cannot publish duplicate expvar name: %q", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		_, stats, _ := r.snapshot()
+		return stats
+	}))
+	return nil
+}
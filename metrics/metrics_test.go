@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+// publishCount is the number of expvar names published by TestRegistry.
+var publishCount int
+
+type nopCloseWriter struct{ io.Writer }
+
+func (nopCloseWriter) Close() error { return nil }
+
+// fixedStats is a StatsProvider that returns the same Stats every time.
+type fixedStats golfw.Stats
+
+func (fs fixedStats) Stats() golfw.Stats { return golfw.Stats(fs) }
+
+// latencyStats is a StatsProvider and LatencyProvider that returns the same
+// LatencyHistogram every time.
+type latencyStats struct{ h golfw.LatencyHistogram }
+
+func (latencyStats) Stats() golfw.Stats                 { return golfw.Stats{} }
+func (ls latencyStats) Latency() golfw.LatencyHistogram { return ls.h }
+
+func TestRegistry(t *testing.T) {
+	t.Run("duplicate name", func(t *testing.T) {
+		r := NewRegistry()
+		ensure.Error(t, r.Register("a", fixedStats{}))
+		ensure.Error(t, r.Register("a", fixedStats{}), "duplicate")
+		r.Unregister("a")
+		ensure.Error(t, r.Register("a", fixedStats{}))
+	})
+
+	t.Run("prometheus", func(t *testing.T) {
+		r := NewRegistry()
+		ensure.Error(t, r.Register("b", fixedStats{LinesWritten: 3, BytesIn: 30, BytesFlushed: 24, Flushes: 2, SinkErrors: 1, Buffered: 6, PeakBuffered: 16, PartialLinesAtClose: 1, Dropped: 4, Spooled: 12, SpoolBytes: 5}))
+		ensure.Error(t, r.Register("a \"quoted\"\\name\n", fixedStats{}))
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		if got, want := rec.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+
+		want := `# HELP golfw_lines_written_total Lines written to the underlying writer.
+# TYPE golfw_lines_written_total counter
+golfw_lines_written_total{writer="a \"quoted\"\\name\n"} 0
+golfw_lines_written_total{writer="b"} 3
+# HELP golfw_bytes_in_total Bytes accepted by Write.
+# TYPE golfw_bytes_in_total counter
+golfw_bytes_in_total{writer="a \"quoted\"\\name\n"} 0
+golfw_bytes_in_total{writer="b"} 30
+# HELP golfw_bytes_flushed_total Bytes written to the underlying writer.
+# TYPE golfw_bytes_flushed_total counter
+golfw_bytes_flushed_total{writer="a \"quoted\"\\name\n"} 0
+golfw_bytes_flushed_total{writer="b"} 24
+# HELP golfw_flushes_total Writes to the underlying writer.
+# TYPE golfw_flushes_total counter
+golfw_flushes_total{writer="a \"quoted\"\\name\n"} 0
+golfw_flushes_total{writer="b"} 2
+# HELP golfw_sink_errors_total Errors returned by the underlying writer.
+# TYPE golfw_sink_errors_total counter
+golfw_sink_errors_total{writer="a \"quoted\"\\name\n"} 0
+golfw_sink_errors_total{writer="b"} 1
+# HELP golfw_partial_lines_at_close_total Final lines without a delimiter written by Close.
+# TYPE golfw_partial_lines_at_close_total counter
+golfw_partial_lines_at_close_total{writer="a \"quoted\"\\name\n"} 0
+golfw_partial_lines_at_close_total{writer="b"} 1
+# HELP golfw_dropped_chunks_total Chunks of lines discarded because the queue was full.
+# TYPE golfw_dropped_chunks_total counter
+golfw_dropped_chunks_total{writer="a \"quoted\"\\name\n"} 0
+golfw_dropped_chunks_total{writer="b"} 4
+# HELP golfw_spooled_bytes_total Bytes appended to the spool.
+# TYPE golfw_spooled_bytes_total counter
+golfw_spooled_bytes_total{writer="a \"quoted\"\\name\n"} 0
+golfw_spooled_bytes_total{writer="b"} 12
+# HELP golfw_buffered_bytes Bytes currently buffered.
+# TYPE golfw_buffered_bytes gauge
+golfw_buffered_bytes{writer="a \"quoted\"\\name\n"} 0
+golfw_buffered_bytes{writer="b"} 6
+# HELP golfw_peak_buffered_bytes Largest number of bytes buffered.
+# TYPE golfw_peak_buffered_bytes gauge
+golfw_peak_buffered_bytes{writer="a \"quoted\"\\name\n"} 0
+golfw_peak_buffered_bytes{writer="b"} 16
+# HELP golfw_spool_bytes Bytes currently in the spool.
+# TYPE golfw_spool_bytes gauge
+golfw_spool_bytes{writer="a \"quoted\"\\name\n"} 0
+golfw_spool_bytes{writer="b"} 5
+`
+		if got := rec.Body.String(); got != want {
+			t.Errorf("GOT:\n%s\nWANT:\n%s", got, want)
+		}
+	})
+
+	t.Run("latency histogram", func(t *testing.T) {
+		var h golfw.LatencyHistogram
+		h.Counts[0] = 2
+		h.Counts[3] = 1
+		h.Counts[len(h.Counts)-1] = 1
+		h.Count = 4
+		h.Sum = 20*time.Second + 1500*time.Microsecond
+
+		r := NewRegistry()
+		ensure.Error(t, r.Register("app", latencyStats{h}))
+		ensure.Error(t, r.Register("other", fixedStats{}))
+
+		buf := new(bytes.Buffer)
+		ensure.Error(t, r.WritePrometheus(buf))
+		got := buf.String()
+		got = got[strings.Index(got, "# HELP golfw_sink_write_duration_seconds"):]
+
+		want := `# HELP golfw_sink_write_duration_seconds Duration of writes to the underlying writer.
+# TYPE golfw_sink_write_duration_seconds histogram
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.0001"} 2
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.00025"} 2
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.0005"} 2
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.001"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.0025"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.005"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.01"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.025"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.05"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.1"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.25"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="0.5"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="1"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="2.5"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="5"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="10"} 3
+golfw_sink_write_duration_seconds_bucket{writer="app",le="+Inf"} 4
+golfw_sink_write_duration_seconds_sum{writer="app"} 20.0015
+golfw_sink_write_duration_seconds_count{writer="app"} 4
+`
+		if got != want {
+			t.Errorf("GOT:\n%s\nWANT:\n%s", got, want)
+		}
+	})
+
+	t.Run("server with WriteCloser", func(t *testing.T) {
+		lf, err := golfw.NewWriteCloser(nopCloseWriter{new(bytes.Buffer)}, 4)
+		ensure.Error(t, err)
+		_, err = lf.Write([]byte("line 1\nline 2"))
+		ensure.Error(t, err)
+
+		r := NewRegistry()
+		ensure.Error(t, r.Register("app", lf))
+
+		server := httptest.NewServer(r)
+		defer server.Close()
+
+		resp, err := server.Client().Get(server.URL)
+		ensure.Error(t, err)
+		body, err := io.ReadAll(resp.Body)
+		ensure.Error(t, err)
+		ensure.Error(t, resp.Body.Close())
+
+		for _, line := range []string{
+			`golfw_lines_written_total{writer="app"} 1`,
+			`golfw_bytes_in_total{writer="app"} 13`,
+			`golfw_buffered_bytes{writer="app"} 6`,
+			`# TYPE golfw_sink_write_duration_seconds histogram`,
+			`golfw_sink_write_duration_seconds_bucket{writer="app",le="+Inf"} 1`,
+			`golfw_sink_write_duration_seconds_count{writer="app"} 1`,
+		} {
+			if !strings.Contains(string(body), line+"\n") {
+				t.Errorf("GOT: %s; WANT: %q", body, line)
+			}
+		}
+	})
+
+	t.Run("expvar", func(t *testing.T) {
+		r := NewRegistry()
+		ensure.Error(t, r.Register("app", fixedStats{LinesWritten: 3, Buffered: 6}))
+		// Each run publishes a new name, because expvar cannot unpublish one.
+		publishCount++
+		name := "golfw_test_" + strconv.Itoa(publishCount)
+		ensure.Error(t, r.TryPublish(name))
+		ensure.Error(t, r.TryPublish(name), "duplicate expvar name")
+
+		var got map[string]golfw.Stats
+		ensure.Error(t, json.Unmarshal([]byte(expvar.Get(name).String()), &got))
+		if want := (golfw.Stats{LinesWritten: 3, Buffered: 6}); got["app"] != want {
+			t.Errorf("GOT: %+v; WANT: %+v", got["app"], want)
+		}
+
+		rec := httptest.NewRecorder()
+		expvar.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+		if !strings.Contains(rec.Body.String(), `"`+name+`": {"app":{"LinesWritten":3`) {
+			t.Errorf("GOT: %s", rec.Body.String())
+		}
+	})
+}
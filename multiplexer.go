@@ -0,0 +1,124 @@
+package golfw
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrWriterClosed is returned when writing to a Multiplexer writer after it
+// has been closed.
+var ErrWriterClosed = errors.New("cannot write to closed writer")
+
+// Multiplexer hands out independent io.WriteCloser writers that share a single
+// WriteCloser. Each writer maintains its own partial line buffer, and only
+// commits complete lines to the shared WriteCloser, so lines from different
+// writers are never spliced together.
+//
+//     func Example(workers []*exec.Cmd) error {
+//         lf, err := golfw.NewWriteCloser(os.Stdout, 4096)
+//         if err != nil {
+//             return err
+//         }
+//         mux := golfw.NewMultiplexer(lf)
+//         for _, cmd := range workers {
+//             cmd.Stdout = mux.Writer()
+//         }
+//         // ...run workers, and close each writer when its worker exits...
+//         return mux.Close()
+//     }
+type Multiplexer struct {
+	wc *WriteCloser
+}
+
+// NewMultiplexer returns a Multiplexer that commits complete lines from each
+// of its writers to wc.
+func NewMultiplexer(wc *WriteCloser) *Multiplexer {
+	return &Multiplexer{wc: wc}
+}
+
+// Writer returns a new io.WriteCloser with its own partial line buffer. Closing
+// the returned writer flushes its final partial line, terminated with a LF,
+// but does not close the shared WriteCloser.
+func (m *Multiplexer) Writer() io.WriteCloser {
+	return &muxWriter{wc: m.wc}
+}
+
+// Close closes the shared WriteCloser. Writers that have not yet been closed
+// should be closed prior to invoking this method, otherwise their final partial
+// lines will be lost.
+func (m *Multiplexer) Close() error {
+	return m.wc.Close()
+}
+
+// muxWriter accumulates bytes until it has one or more complete lines, then
+// writes those lines to the shared WriteCloser with a single Write call.
+type muxWriter struct {
+	lock   sync.Mutex
+	buf    []byte // partial line waiting for LF
+	wc     *WriteCloser
+	closed bool
+}
+
+// Write appends bytes from p to the writer's partial line buffer, then writes
+// all complete lines to the shared WriteCloser.
+func (mw *muxWriter) Write(p []byte) (int, error) {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if mw.closed {
+		return 0, ErrWriterClosed
+	}
+
+	olen := len(mw.buf)
+	mw.buf = append(mw.buf, p...)
+
+	// The buffer holds no complete delimiter prior to this write, but a
+	// multiple byte delimiter may have been split across two writes.
+	start := olen - len(mw.wc.delimiter) + 1
+	if start < 0 {
+		start = 0
+	}
+	finalIndex := lastDelimiter(mw.buf, mw.wc.delimiter, start)
+	if finalIndex < 0 {
+		return len(p), nil
+	}
+
+	nw, err := mw.wc.Write(mw.buf[:finalIndex+1])
+	if err != nil {
+		// nb is the number of bytes from p that got written.
+		nb := nw - olen
+		if nb < 0 {
+			// Not even the previously buffered partial line was consumed.
+			nc := copy(mw.buf, mw.buf[nw:olen])
+			mw.buf = mw.buf[:nc]
+			return 0, err
+		}
+		mw.buf = mw.buf[:0]
+		return nb, err
+	}
+
+	nc := copy(mw.buf, mw.buf[finalIndex+1:])
+	mw.buf = mw.buf[:nc]
+	return len(p), nil
+}
+
+// Close writes the final partial line, if any, terminated with the delimiter of
+// the shared WriteCloser, to the shared WriteCloser. It does not close the
+// shared WriteCloser.
+func (mw *muxWriter) Close() error {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if mw.closed {
+		return ErrWriterClosed
+	}
+	mw.closed = true
+
+	if len(mw.buf) == 0 {
+		return nil
+	}
+	_, err := mw.wc.Write(append(mw.buf, mw.wc.delimiter...))
+	mw.buf = nil
+	return err
+}
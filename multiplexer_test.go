@@ -0,0 +1,143 @@
+package golfw
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestMultiplexer(t *testing.T) {
+	t.Run("partial lines are not spliced", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1)
+		ensureError(t, err)
+		mux := NewMultiplexer(wc)
+
+		a := mux.Writer()
+		b := mux.Writer()
+
+		for _, tc := range []struct {
+			w io.Writer
+			p string
+		}{
+			{a, "alpha "},
+			{b, "bravo "},
+			{a, "one\nalpha "},
+			{b, "two\n"},
+			{a, "three"},
+		} {
+			n, err := tc.w.Write([]byte(tc.p))
+			ensureError(t, err)
+			if got, want := n, len(tc.p); got != want {
+				t.Errorf("GOT: %v; WANT: %v", got, want)
+			}
+		}
+		ensureBuffer(t, output, "alpha one\nbravo two\n")
+
+		ensureError(t, a.Close())
+		ensureError(t, b.Close())
+		ensureBuffer(t, output, "alpha one\nbravo two\nalpha three\n")
+
+		ensureError(t, mux.Close())
+	})
+
+	t.Run("close does not close shared sink", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 64)
+		ensureError(t, err)
+		mux := NewMultiplexer(wc)
+
+		a := mux.Writer()
+		_, err = a.Write([]byte("partial"))
+		ensureError(t, err)
+		ensureError(t, a.Close())
+
+		_, err = a.Write([]byte("more"))
+		ensureError(t, err, ErrWriterClosed.Error())
+		ensureError(t, a.Close(), ErrWriterClosed.Error())
+
+		b := mux.Writer()
+		_, err = b.Write([]byte("still open\n"))
+		ensureError(t, err)
+
+		ensureError(t, mux.Close())
+		ensureBuffer(t, output, "partial\nstill open\n")
+	})
+
+	t.Run("close without partial line", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 64)
+		ensureError(t, err)
+		mux := NewMultiplexer(wc)
+
+		a := mux.Writer()
+		_, err = a.Write([]byte("complete\n"))
+		ensureError(t, err)
+		ensureError(t, a.Close())
+		ensureError(t, mux.Close())
+		ensureBuffer(t, output, "complete\n")
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		wc, err := NewWriteCloser(&errOnWrite{}, 1)
+		ensureError(t, err)
+		mux := NewMultiplexer(wc)
+
+		a := mux.Writer()
+		_, err = a.Write([]byte("partial"))
+		ensureError(t, err)
+
+		n, err := a.Write([]byte(" line\n"))
+		ensureError(t, err, "test write error")
+		if got, want := n, 0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		const writers = 8
+		const lines = 200
+
+		output := new(lockedBuffer)
+		wc, err := NewWriteCloser(output, 128)
+		ensureError(t, err)
+		mux := NewMultiplexer(wc)
+
+		var wg sync.WaitGroup
+		wg.Add(writers)
+		for i := 0; i < writers; i++ {
+			go func(i int) {
+				defer wg.Done()
+				w := mux.Writer()
+				defer func() { ensureError(t, w.Close()) }()
+				for j := 0; j < lines; j++ {
+					// Write each line in three fragments.
+					for _, fragment := range []string{fmt.Sprintf("writer %d", i), " line ", fmt.Sprintf("%d\n", j)} {
+						if _, err := w.Write([]byte(fragment)); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		ensureError(t, mux.Close())
+
+		var count int
+		scanner := bufio.NewScanner(bytes.NewReader([]byte(output.String())))
+		for scanner.Scan() {
+			var i, j int
+			if _, err := fmt.Sscanf(scanner.Text(), "writer %d line %d", &i, &j); err != nil {
+				t.Fatalf("spliced line: %q", scanner.Text())
+			}
+			count++
+		}
+		if got, want := count, writers*lines; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+// Package netsink provides a writer that sends the chunks of lines written to
+// it over a TCP or unix stream socket, dialing lazily and reconnecting with
+// exponential backoff after errors. It is designed to be the underlying
+// io.WriteCloser of a golfw.WriteCloser, which only hands it chunks of
+// complete lines. When sending a chunk fails, the connection is closed, and
+// the entire chunk is sent again over the next connection, so the remote
+// collector never receives part of a line on a connection that remains open.
+//
+//     func Example() error {
+//         ns, err := netsink.New("tcp", "collector:5170", &netsink.Options{
+//             MaxBackoff: time.Minute,
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(ns, 16384)
+//         if err != nil {
+//             _ = ns.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes ns.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package netsink
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Defaults used when Options does not specify a value.
+const (
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultMaxPending     = 1 << 20
+)
+
+// ErrPendingFull is returned by Write when the chunks waiting to be sent
+// already hold the maximum number of pending bytes.
+var ErrPendingFull = errors.New("pending chunks full")
+
+// Options configures a Conn.
+type Options struct {
+	// DialTimeout is the maximum duration to wait for a connection to be
+	// established. When zero, there is no timeout beyond that of the
+	// operating system.
+	DialTimeout time.Duration
+
+	// InitialBackoff is the duration to wait after the first failed attempt
+	// to dial or send, before dialing again. When zero,
+	// DefaultInitialBackoff is used.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum duration to wait before dialing again. The
+	// backoff doubles after each consecutive failure, up to this duration.
+	// When zero, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+
+	// MaxPending is the maximum number of bytes of chunks waiting to be sent
+	// while the remote collector is unavailable. A single chunk larger than
+	// MaxPending is accepted when no other chunks are pending. When zero,
+	// DefaultMaxPending is used.
+	MaxPending int
+
+	// OnError, when not nil, is invoked with each error from dialing or
+	// sending.
+	OnError func(error)
+}
+
+// Conn is an io.WriteCloser that sends the chunks written to it over a stream
+// socket. Each chunk is copied to a queue of pending chunks, and all pending
+// chunks are sent, with a single writev system call when the connection
+// supports it. While the remote collector is unavailable, chunks remain
+// pending until a later Write, Flush, or Close sends them. Its methods are
+// safe to invoke from multiple goroutines.
+type Conn struct {
+	lock         sync.Mutex
+	network      string
+	address      string
+	options      Options
+	conn         net.Conn
+	pending      [][]byte
+	pendingBytes int
+	buffers      [][]byte // reused for writev, which consumes its slice
+	failures     int      // consecutive failures
+	nextDial     time.Time
+	lastErr      error
+	closed       bool
+	now          func() time.Time
+	dial         func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+// New returns a Conn that sends chunks to address. The network is "tcp",
+// "tcp4", "tcp6", or "unix". It does not dial until the first Write. When
+// options is nil, the defaults described by Options are used.
+func New(network, address string, options *Options) (*Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, fmt.Errorf("cannot create Conn with unsupported network: %q", network)
+	}
+	c := &Conn{network: network, address: address, now: time.Now, dial: net.DialTimeout}
+	if options != nil {
+		c.options = *options
+	}
+	if c.options.InitialBackoff < 0 {
+		return nil, fmt.Errorf("cannot create Conn when InitialBackoff less than 0: %v", c.options.InitialBackoff)
+	}
+	if c.options.MaxBackoff < 0 {
+		return nil, fmt.Errorf("cannot create Conn when MaxBackoff less than 0: %v", c.options.MaxBackoff)
+	}
+	if c.options.MaxPending < 0 {
+		return nil, fmt.Errorf("cannot create Conn when MaxPending less than 0: %d", c.options.MaxPending)
+	}
+	if c.options.InitialBackoff == 0 {
+		c.options.InitialBackoff = DefaultInitialBackoff
+	}
+	if c.options.MaxBackoff == 0 {
+		c.options.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.options.MaxPending == 0 {
+		c.options.MaxPending = DefaultMaxPending
+	}
+	return c, nil
+}
+
+// Write copies p to the queue of pending chunks, then sends all pending chunks,
+// unless it is waiting to dial again after a failure. Because p remains
+// pending after a failure, Write only returns an error when there is no room
+// for p, in which case p is not queued, and ErrPendingFull is returned along
+// with the most recent error from dialing or sending.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return 0, os.ErrClosed
+	}
+	if len(c.pending) > 0 && c.pendingBytes+len(p) > c.options.MaxPending {
+		c.send(false) // attempt to make room
+		if len(c.pending) > 0 && c.pendingBytes+len(p) > c.options.MaxPending {
+			return 0, fmt.Errorf("%w: %v", ErrPendingFull, c.lastErr)
+		}
+	}
+	c.pending = append(c.pending, append([]byte(nil), p...))
+	c.pendingBytes += len(p)
+	c.send(false)
+	return len(p), nil
+}
+
+// Flush sends all pending chunks, dialing immediately when not connected, even
+// when waiting to dial again after a failure. It returns the error from
+// dialing or sending, if any.
+func (c *Conn) Flush() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return os.ErrClosed
+	}
+	return c.send(true)
+}
+
+// send sends all pending chunks, dialing first when not connected. Unless
+// force is true, it does not dial before the backoff following a failure has
+// elapsed.
+func (c *Conn) send(force bool) error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	if c.conn == nil {
+		if !force && c.now().Before(c.nextDial) {
+			return c.lastErr
+		}
+		conn, err := c.dial(c.network, c.address, c.options.DialTimeout)
+		if err != nil {
+			return c.fail(err)
+		}
+		c.conn = conn
+	}
+
+	// WriteTo uses writev when the connection supports it, and consumes the
+	// slice it is invoked on, so it is invoked on a copy of pending.
+	c.buffers = append(c.buffers[:0], c.pending...)
+	buffers := net.Buffers(c.buffers)
+	nw, err := buffers.WriteTo(c.conn)
+
+	// Remove the chunks that were completely sent.
+	var sent int
+	for sent < len(c.pending) && int64(len(c.pending[sent])) <= nw {
+		nw -= int64(len(c.pending[sent]))
+		c.pendingBytes -= len(c.pending[sent])
+		c.pending[sent] = nil
+		sent++
+	}
+	c.pending = append(c.pending[:0], c.pending[sent:]...)
+	for i := range c.buffers {
+		c.buffers[i] = nil
+	}
+
+	if err != nil {
+		// The chunk that was partially sent, if any, remains pending, and
+		// is sent again in its entirety over the next connection.
+		_ = c.conn.Close()
+		c.conn = nil
+		return c.fail(err)
+	}
+	c.failures = 0
+	return nil
+}
+
+// fail records a failure to dial or send, and returns err.
+func (c *Conn) fail(err error) error {
+	backoff := c.options.InitialBackoff
+	for i := 0; i < c.failures && backoff < c.options.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.options.MaxBackoff {
+		backoff = c.options.MaxBackoff
+	}
+	c.failures++
+	c.nextDial = c.now().Add(backoff)
+	c.lastErr = err
+	if c.options.OnError != nil {
+		c.options.OnError(err)
+	}
+	return err
+}
+
+// Close sends all pending chunks, dialing immediately when not connected, then
+// closes the connection. When pending chunks could not be sent, they are
+// discarded, and an error is returned.
+func (c *Conn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return os.ErrClosed
+	}
+	c.closed = true
+
+	err := c.send(true)
+	if err != nil {
+		err = fmt.Errorf("cannot send %d pending bytes: %w", c.pendingBytes, err)
+	}
+	c.pending, c.pendingBytes = nil, 0
+	if c.conn != nil {
+		if cerr := c.conn.Close(); err == nil {
+			err = cerr
+		}
+		c.conn = nil
+	}
+	return err
+}
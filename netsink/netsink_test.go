@@ -0,0 +1,198 @@
+package netsink
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+// fakeConn is a net.Conn that records bytes written to it, and after max bytes
+// fails every write.
+type fakeConn struct {
+	net.Conn
+	buf    bytes.Buffer
+	max    int
+	closed bool
+}
+
+func (fc *fakeConn) Write(p []byte) (int, error) {
+	if fc.closed {
+		return 0, net.ErrClosed
+	}
+	if len(p) > fc.max {
+		n, _ := fc.buf.Write(p[:fc.max])
+		fc.max = 0
+		return n, errors.New("test connection reset")
+	}
+	fc.max -= len(p)
+	return fc.buf.Write(p)
+}
+
+func (fc *fakeConn) Close() error {
+	fc.closed = true
+	return nil
+}
+
+// fakeNetwork dials fakeConn connections, and fails to dial while down.
+type fakeNetwork struct {
+	conns []*fakeConn
+	max   int // max bytes accepted by each new connection
+	down  bool
+	dials int
+}
+
+func (fn *fakeNetwork) dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	fn.dials++
+	if fn.down {
+		return nil, errors.New("test connection refused")
+	}
+	fc := &fakeConn{max: fn.max}
+	fn.conns = append(fn.conns, fc)
+	return fc, nil
+}
+
+func newTestConn(tb testing.TB, fn *fakeNetwork, options *Options) (*Conn, *time.Time) {
+	tb.Helper()
+	c, err := New("tcp", "collector:5170", options)
+	ensure.Error(tb, err)
+	now := time.Date(2022, 3, 5, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.dial = fn.dial
+	return c, &now
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("udp", "collector:5170", nil)
+	ensure.Error(t, err, "unsupported network")
+	_, err = New("tcp", "collector:5170", &Options{MaxPending: -1})
+	ensure.Error(t, err, "MaxPending")
+}
+
+func TestConn(t *testing.T) {
+	t.Run("dials lazily", func(t *testing.T) {
+		fn := &fakeNetwork{max: 1024}
+		c, _ := newTestConn(t, fn, nil)
+		if got, want := fn.dials, 0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Write(t, c, "line 1\n")
+		ensure.Write(t, c, "line 2\n")
+		if got, want := fn.dials, 1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.String(t, fn.conns[0].buf.String(), "line 1\nline 2\n")
+		ensure.Error(t, c.Close())
+		ensure.Error(t, c.Close(), "closed")
+	})
+
+	t.Run("resends failed chunk over new connection", func(t *testing.T) {
+		fn := &fakeNetwork{max: 10}
+		var errs []error
+		c, now := newTestConn(t, fn, &Options{OnError: func(err error) { errs = append(errs, err) }})
+
+		ensure.Write(t, c, "line 1\n")
+		ensure.Write(t, c, "line 2\n") // only "lin" sent before reset
+		ensure.String(t, fn.conns[0].buf.String(), "line 1\nlin")
+		if got, want := len(errs), 1; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", got, want)
+		}
+
+		// Chunks queue while waiting to dial again.
+		fn.max = 1024
+		*now = now.Add(DefaultInitialBackoff - time.Nanosecond)
+		ensure.Write(t, c, "line 3\n")
+		if got, want := len(fn.conns), 1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		*now = now.Add(time.Nanosecond)
+		ensure.Write(t, c, "line 4\n")
+		ensure.String(t, fn.conns[1].buf.String(), "line 2\nline 3\nline 4\n")
+		ensure.Error(t, c.Close())
+	})
+
+	t.Run("backoff grows", func(t *testing.T) {
+		fn := &fakeNetwork{down: true}
+		c, now := newTestConn(t, fn, &Options{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second})
+
+		for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+			dials := fn.dials
+			ensure.Write(t, c, "line\n")
+			if got, want := fn.dials, dials+1; got != want {
+				t.Fatalf("GOT: %v; WANT: %v", got, want)
+			}
+			*now = now.Add(backoff - time.Nanosecond)
+			ensure.Write(t, c, "line\n")
+			if got, want := fn.dials, dials+1; got != want {
+				t.Fatalf("GOT: %v; WANT: %v", got, want)
+			}
+			*now = now.Add(time.Nanosecond)
+		}
+	})
+
+	t.Run("pending full", func(t *testing.T) {
+		fn := &fakeNetwork{down: true}
+		c, _ := newTestConn(t, fn, &Options{MaxPending: 10})
+
+		ensure.Write(t, c, "line 1\n")
+		n, err := c.Write([]byte("line 2\n"))
+		if got, want := n, 0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if !errors.Is(err, ErrPendingFull) {
+			t.Errorf("GOT: %v; WANT: %v", err, ErrPendingFull)
+		}
+		ensure.Error(t, err, "test connection refused")
+
+		// Flush ignores backoff.
+		fn.down = false
+		fn.max = 1024
+		ensure.Error(t, c.Flush())
+		ensure.Write(t, c, "line 2\n")
+		ensure.String(t, fn.conns[0].buf.String(), "line 1\nline 2\n")
+	})
+
+	t.Run("close discards unsent chunks", func(t *testing.T) {
+		fn := &fakeNetwork{down: true}
+		c, _ := newTestConn(t, fn, nil)
+
+		ensure.Write(t, c, "line 1\n")
+		ensure.Error(t, c.Close(), "cannot send 7 pending bytes: test connection refused")
+	})
+}
+
+func TestTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ensure.Error(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		buf, _ := io.ReadAll(conn)
+		received <- string(buf)
+	}()
+
+	ns, err := New("tcp", ln.Addr().String(), nil)
+	ensure.Error(t, err)
+	lf, err := golfw.NewWriteCloser(ns, 8)
+	ensure.Error(t, err)
+	ensure.Write(t, lf, "line 1\nline 2\npartial")
+	ensure.Error(t, lf.Close())
+
+	select {
+	case got := <-received:
+		ensure.String(t, got, "line 1\nline 2\npartial")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for collector")
+	}
+}
@@ -0,0 +1,250 @@
+package golfw
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Option is used to configure a WriteCloser when it is created by
+// NewWriteCloser.
+type Option func(*WriteCloser) error
+
+// WithContinuationMarker configures the marker emitted at the end of each but
+// the final segment of a line split by the SplitLongLines policy, rather than
+// DefaultContinuationMarker. The marker may be empty.
+func WithContinuationMarker(marker []byte) Option {
+	return func(lbf *WriteCloser) error {
+		lbf.continuationMarker = append([]byte(nil), marker...)
+		return nil
+	}
+}
+
+// WithCompleteShortWrites configures the WriteCloser to complete short writes
+// to the underlying io.WriteCloser. Many io.WriteCloser implementations, such
+// as pipes and sockets, may accept fewer bytes than requested. Rather than
+// returning io.ErrShortWrite to the caller, the WriteCloser writes the
+// remaining bytes until the entire chunk of lines has been written, or a write
+// makes no progress, or returns an error other than io.ErrShortWrite. Writes
+// that make no progress are retried when WithRetry is also configured.
+func WithCompleteShortWrites() Option {
+	return func(lbf *WriteCloser) error {
+		lbf.completeShortWrites = true
+		return nil
+	}
+}
+
+// WithDelimiter configures the WriteCloser to use the specified record
+// delimiter rather than LF. The delimiter may be a single byte, such as NUL for
+// records produced by `find -print0`, or RS for RFC 7464 JSON text sequences,
+// or multiple bytes, such as CRLF. A multiple byte delimiter is detected even
+// when it is split across two calls to Write.
+func WithDelimiter(delimiter []byte) Option {
+	return func(lbf *WriteCloser) error {
+		if len(delimiter) == 0 {
+			return errors.New("cannot use empty delimiter")
+		}
+		lbf.delimiter = append([]byte(nil), delimiter...)
+		return nil
+	}
+}
+
+// WithMaxLineLength configures the maximum number of bytes of a line, not
+// including its delimiter, and the policy used for lines that exceed it. This
+// protects programs from unbounded buffer growth when a producer never writes
+// a delimiter.
+func WithMaxLineLength(maxLineLength int, policy LongLinePolicy) Option {
+	return func(lbf *WriteCloser) error {
+		if maxLineLength <= 0 {
+			return fmt.Errorf("cannot use maximum line length less than or equal to 0: %d", maxLineLength)
+		}
+		switch policy {
+		case SplitLongLines, TruncateLongLines, RejectLongLines:
+		default:
+			return fmt.Errorf("cannot use unknown long line policy: %d", policy)
+		}
+		lbf.maxLineLength = maxLineLength
+		lbf.longLinePolicy = policy
+		return nil
+	}
+}
+
+// WithRetry configures the WriteCloser to retry failed writes to the
+// underlying io.WriteCloser according to the policy, waiting with exponential
+// backoff between attempts. Each retry writes only the bytes of the chunk that
+// were not yet written, preserving line boundaries. Because retries are
+// performed while the WriteCloser is locked, other calls to its methods block
+// until the retries complete.
+func WithRetry(policy RetryPolicy) Option {
+	return func(lbf *WriteCloser) error {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		policy = policy.withDefaults()
+		lbf.retry = &policy
+		return nil
+	}
+}
+
+// WithSpool configures the WriteCloser to append lines to segment files in the
+// specified directory when they cannot be written to the underlying
+// io.WriteCloser, rather than returning the error. Before each subsequent
+// write to the underlying io.WriteCloser, the spooled lines are replayed, oldest
+// first, so lines reach the underlying io.WriteCloser in the order they were
+// written, and no line is written after a spooled line until the spool has
+// been replayed. A new segment is started when appending to the final segment
+// would cause it to exceed segmentSize bytes. When maxSize is greater than 0,
+// and spooling lines would cause the spool to exceed maxSize bytes, the lines
+// are not spooled, and the write error is returned along with ErrSpoolFull.
+//
+// The spool survives a process restart: segments found in the directory when
+// the WriteCloser is created are replayed before any new lines. Because a
+// final partial line in the spool would otherwise be joined with the first
+// line written by the next process, Close appends the delimiter to the spool
+// when it does not end with one, as does creating a WriteCloser with a spool
+// left by a process that did not invoke Close. The directory should not be
+// shared by more than one WriteCloser.
+func WithSpool(dir string, segmentSize, maxSize int64) Option {
+	return func(lbf *WriteCloser) error {
+		if segmentSize <= 0 {
+			return fmt.Errorf("cannot use spool segment size less than or equal to 0: %d", segmentSize)
+		}
+		if maxSize < 0 {
+			return fmt.Errorf("cannot use spool maximum size less than 0: %d", maxSize)
+		}
+		s, err := openSpool(dir, segmentSize, maxSize)
+		if err != nil {
+			return err
+		}
+		lbf.spool = s
+		return nil
+	}
+}
+
+// WithStrictFlushes configures the WriteCloser so that when a write to the
+// underlying io.WriteCloser fails, all unwritten bytes remain in the buffer,
+// including those from the Write that triggered the flush, and the error is a
+// *FlushError that reports exactly how many lines and bytes were written. A
+// later flush resumes with the first unwritten byte, so the underlying
+// io.WriteCloser receives every line exactly once, even when it failed after
+// writing only part of a line. Because the bytes are retained, Write reports
+// they were all written, along with the *FlushError.
+//
+// Without this option, when a flush fails, Write discards the bytes from p that
+// were not written, and returns the number of bytes from p that were written,
+// so the caller may write the remaining bytes again.
+func WithStrictFlushes() Option {
+	return func(lbf *WriteCloser) error {
+		lbf.strictFlushes = true
+		return nil
+	}
+}
+
+// WithSlowFlush configures a callback that is invoked whenever a single write
+// to the underlying io.WriteCloser takes at least the specified duration. The
+// callback receives the duration of the write, and the byte count and error it
+// returned. It is invoked synchronously while the WriteCloser is locked, and
+// therefore must not invoke any methods of the WriteCloser. When combined with
+// WithAsync, the measured write is the write to the queue.
+func WithSlowFlush(threshold time.Duration, callback func(elapsed time.Duration, n int, err error)) Option {
+	return func(lbf *WriteCloser) error {
+		if threshold <= 0 {
+			return fmt.Errorf("cannot use slow flush threshold less than or equal to 0: %v", threshold)
+		}
+		if callback == nil {
+			return errors.New("cannot use nil slow flush callback")
+		}
+		lbf.slowFlushThreshold = threshold
+		lbf.slowFlushCallback = callback
+		return nil
+	}
+}
+
+// WithLineAtomicWrites configures the WriteCloser so each call to Write is
+// treated as carrying only complete lines. When the bytes passed to Write do
+// not end with a LF, or the delimiter configured by WithDelimiter, one is
+// appended. This guarantees that when multiple
+// goroutines share a single WriteCloser, the underlying io.WriteCloser never
+// receives a line that contains bytes from more than one Write invocation.
+//
+// Without this option, a WriteCloser is still safe for concurrent use, but
+// a goroutine that writes a partial line may have its line completed by bytes
+// from a different goroutine. To stream partial lines from multiple sources
+// into a single WriteCloser, see Multiplexer.
+func WithLineAtomicWrites() Option {
+	return func(lbf *WriteCloser) error {
+		lbf.lineAtomic = true
+		return nil
+	}
+}
+
+// WithAsync configures the WriteCloser to flush completed lines to a bounded
+// queue of the specified number of chunks, from which a background goroutine
+// writes them to the underlying io.WriteCloser, so a slow underlying
+// io.WriteCloser does not stall Write. The policy determines the behavior of a
+// flush when the queue is full.
+//
+// When the background goroutine fails to write a chunk, the remainder of that
+// chunk is discarded, and the error is returned by the next flush, which
+// retains its lines in the buffer. Close waits for the queue to drain, bounded
+// by the duration configured by WithDrainTimeout.
+func WithAsync(queueSize int, policy QueueFullPolicy) Option {
+	return func(lbf *WriteCloser) error {
+		if queueSize <= 0 {
+			return fmt.Errorf("cannot use queue size less than or equal to 0: %d", queueSize)
+		}
+		switch policy {
+		case BlockWhenFull, DropNewest, DropOldest:
+		default:
+			return fmt.Errorf("cannot use unknown queue full policy: %d", policy)
+		}
+		lbf.asyncQueueSize = queueSize
+		lbf.asyncPolicy = policy
+		return nil
+	}
+}
+
+// WithClock configures the WriteCloser to use the specified Clock rather than
+// the system clock.
+func WithClock(clock Clock) Option {
+	return func(lbf *WriteCloser) error {
+		if clock == nil {
+			return errors.New("cannot use nil Clock")
+		}
+		lbf.clock = clock
+		return nil
+	}
+}
+
+// WithDrainTimeout configures the maximum duration Close waits for the queue
+// of a WriteCloser configured by WithAsync to drain. When the timeout elapses,
+// the remaining queued lines are discarded, and Close returns an error that
+// wraps ErrDrainTimeout. Without this option, Close waits until the queue is
+// drained. In either case, Close waits for a chunk that is being written to the
+// underlying io.WriteCloser before closing it, so Close blocks indefinitely when
+// that write never returns. Sinks that may hang should bound their own writes,
+// for instance with a write deadline.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(lbf *WriteCloser) error {
+		if timeout <= 0 {
+			return fmt.Errorf("cannot use drain timeout less than or equal to 0: %v", timeout)
+		}
+		lbf.drainTimeout = timeout
+		return nil
+	}
+}
+
+// WithFlushInterval configures the maximum duration completed lines may
+// remain in the buffer. Completed lines are flushed to the underlying
+// io.WriteCloser no later than the specified interval after they were written,
+// even when the flush threshold has not been reached. Bytes after the final LF
+// remain in the buffer.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(lbf *WriteCloser) error {
+		if interval <= 0 {
+			return fmt.Errorf("cannot use flush interval less than or equal to 0: %v", interval)
+		}
+		lbf.flushInterval = interval
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+// Package reopen provides a file that can be reopened at its original path,
+// for use with external log rotation programs such as logrotate. It is
+// designed to be the underlying io.WriteCloser of a golfw.WriteCloser, which
+// only hands it complete lines, so no line ever straddles two files.
+//
+// When logrotate is configured to move the file and then send a signal, invoke
+// Notify so the file is reopened when the signal is received. When logrotate
+// is configured with copytruncate, no signal is needed, because the file is
+// opened in append mode, and writes continue at the new end of the truncated
+// file.
+//
+//     func Example() error {
+//         rf, err := reopen.New("/var/log/app.log", nil)
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(rf, 16384)
+//         if err != nil {
+//             _ = rf.Close()
+//             return err
+//         }
+//         rf.Notify(lf, syscall.SIGHUP)
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes rf.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package reopen
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Options configures a File.
+type Options struct {
+	// Perm is the permission bits used when creating a file. When zero, 0644
+	// is used.
+	Perm os.FileMode
+
+	// CheckInterval is the minimum duration between checks of whether the
+	// file at the path has been removed or replaced, for instance by a
+	// different inode. When zero, the check is performed prior to every
+	// write.
+	CheckInterval time.Duration
+}
+
+// Flusher is implemented by golfw.WriteCloser, and allows a File to flush all
+// complete lines into the current file prior to reopening it.
+type Flusher interface {
+	Flush() error
+}
+
+// File is an io.WriteCloser that writes to a file, and reopens the file at its
+// original path when requested, or when it detects the file at its path was
+// removed or replaced. Its methods are safe to invoke from multiple
+// goroutines.
+type File struct {
+	lock    sync.Mutex
+	path    string
+	options Options
+	fh      *os.File
+	fi      os.FileInfo // identifies the opened file
+	checked time.Time   // when path was last checked for removal or replacement
+	now     func() time.Time
+	signals chan os.Signal // non-nil while notifying
+	done    chan struct{}
+}
+
+// New returns a File that appends to the file at the specified path, creating
+// it when necessary.
+func New(path string, options *Options) (*File, error) {
+	f := &File{path: path, now: time.Now}
+	if options != nil {
+		f.options = *options
+	}
+	if f.options.Perm == 0 {
+		f.options.Perm = 0644
+	}
+	fh, fi, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	f.fh, f.fi, f.checked = fh, fi, f.now()
+	return f, nil
+}
+
+// open opens the file at the path for appending, creating it when necessary.
+func (f *File) open() (*os.File, os.FileInfo, error) {
+	fh, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, f.options.Perm)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		_ = fh.Close()
+		return nil, nil, err
+	}
+	return fh, fi, nil
+}
+
+// Write writes p to the file, first reopening the file when the file at the
+// path was removed or replaced since it was opened.
+func (f *File) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fh == nil {
+		return 0, os.ErrClosed
+	}
+	if now := f.now(); now.Sub(f.checked) >= f.options.CheckInterval {
+		f.checked = now
+		if fi, err := os.Stat(f.path); err != nil || !os.SameFile(fi, f.fi) {
+			if err = f.reopen(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return f.fh.Write(p)
+}
+
+// Reopen closes the file, then opens the file at the original path, creating
+// it when necessary. When the file at the path cannot be opened, the
+// previously opened file remains in use.
+func (f *File) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fh == nil {
+		return os.ErrClosed
+	}
+	return f.reopen()
+}
+
+func (f *File) reopen() error {
+	fh, fi, err := f.open()
+	if err != nil {
+		return err
+	}
+	err = f.fh.Close()
+	f.fh, f.fi, f.checked = fh, fi, f.now()
+	return err
+}
+
+// Notify causes the file to be reopened whenever one of the specified signals
+// is received. When flusher is not nil, its Flush method is invoked before the
+// file is reopened, so all complete lines it has buffered are written to the
+// file at the original path before it is reopened. Invoking Notify again
+// replaces the flusher and signals of the previous invocation.
+func (f *File) Notify(flusher Flusher, sig ...os.Signal) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.stopNotify()
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	f.signals, f.done = signals, done
+	signal.Notify(signals, sig...)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if flusher != nil {
+					_ = flusher.Flush()
+				}
+				_ = f.Reopen() // previous file remains in use on error
+			}
+		}
+	}()
+}
+
+// stopNotify stops delivery of signals and causes the notify goroutine to
+// return. It does not wait for the goroutine, which may be blocked flushing a
+// flusher that is closing this File.
+func (f *File) stopNotify() {
+	if f.signals != nil {
+		signal.Stop(f.signals)
+		close(f.done)
+		f.signals, f.done = nil, nil
+	}
+}
+
+// Close stops reopening the file when signals are received, and closes the
+// file.
+func (f *File) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fh == nil {
+		return os.ErrClosed
+	}
+	f.stopNotify()
+	err := f.fh.Close()
+	f.fh, f.fi = nil, nil
+	return err
+}
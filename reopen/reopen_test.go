@@ -0,0 +1,134 @@
+package reopen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+func TestFile(t *testing.T) {
+	t.Run("appends to existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		ensure.Error(t, os.WriteFile(path, []byte("line 1\n"), 0644))
+
+		f, err := New(path, nil)
+		ensure.Error(t, err)
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Close())
+		ensure.File(t, path, "line 1\nline 2\n")
+	})
+
+	t.Run("cannot open", func(t *testing.T) {
+		_, err := New(filepath.Join(t.TempDir(), "missing", "app.log"), nil)
+		ensure.Error(t, err, "no such file")
+	})
+
+	t.Run("reopen after move", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		moved := filepath.Join(dir, "app.log.1")
+
+		f, err := New(path, &Options{CheckInterval: time.Hour})
+		ensure.Error(t, err)
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, os.Rename(path, moved))
+		ensure.Write(t, f, "line 2\n") // still written to moved file
+		ensure.Error(t, f.Reopen())
+		ensure.Write(t, f, "line 3\n")
+		ensure.Error(t, f.Close())
+
+		ensure.File(t, moved, "line 1\nline 2\n")
+		ensure.File(t, path, "line 3\n")
+	})
+
+	t.Run("reopen failure keeps previous file", func(t *testing.T) {
+		dir := t.TempDir()
+		sub := filepath.Join(dir, "sub")
+		ensure.Error(t, os.Mkdir(sub, 0755))
+		path := filepath.Join(sub, "app.log")
+		moved := filepath.Join(dir, "app.log")
+
+		f, err := New(path, &Options{CheckInterval: time.Hour})
+		ensure.Error(t, err)
+		ensure.Error(t, os.Rename(path, moved))
+		ensure.Error(t, os.Remove(sub))
+		ensure.Error(t, f.Reopen(), "no such file")
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, f.Close())
+		ensure.File(t, moved, "line 1\n")
+	})
+
+	t.Run("detects removal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+
+		f, err := New(path, nil)
+		ensure.Error(t, err)
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, os.Remove(path))
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Close())
+		ensure.File(t, path, "line 2\n")
+	})
+
+	t.Run("detects replacement", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		replacement := filepath.Join(dir, "replacement")
+
+		f, err := New(path, nil)
+		ensure.Error(t, err)
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, os.WriteFile(replacement, []byte("replaced\n"), 0644))
+		ensure.Error(t, os.Rename(replacement, path))
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Close())
+		ensure.File(t, path, "replaced\nline 2\n")
+	})
+
+	t.Run("check interval", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		moved := filepath.Join(dir, "app.log.1")
+
+		f, err := New(path, &Options{CheckInterval: time.Minute})
+		ensure.Error(t, err)
+		when := time.Date(2022, time.March, 5, 12, 0, 0, 0, time.UTC)
+		f.now = func() time.Time { return when }
+		f.checked = when
+
+		ensure.Error(t, os.Rename(path, moved))
+		when = when.Add(59 * time.Second)
+		ensure.Write(t, f, "line 1\n")
+		when = when.Add(time.Second)
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Close())
+
+		ensure.File(t, moved, "line 1\n")
+		ensure.File(t, path, "line 2\n")
+	})
+
+	t.Run("copytruncate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+
+		f, err := New(path, nil)
+		ensure.Error(t, err)
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, os.Truncate(path, 0))
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Close())
+		ensure.File(t, path, "line 2\n")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := New(filepath.Join(t.TempDir(), "app.log"), nil)
+		ensure.Error(t, err)
+		ensure.Error(t, f.Close())
+		_, err = f.Write([]byte("line 1\n"))
+		ensure.Error(t, err, os.ErrClosed.Error())
+		ensure.Error(t, f.Reopen(), os.ErrClosed.Error())
+		ensure.Error(t, f.Close(), os.ErrClosed.Error())
+	})
+}
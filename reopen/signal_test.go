@@ -0,0 +1,48 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package reopen
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+func TestNotify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	moved := filepath.Join(dir, "app.log.1")
+
+	f, err := New(path, &Options{CheckInterval: time.Hour})
+	ensure.Error(t, err)
+	lf, err := golfw.NewWriteCloser(f, 1024)
+	ensure.Error(t, err)
+	f.Notify(lf, syscall.SIGHUP)
+
+	ensure.Write(t, lf, "line 1\nline 2\npartial ")
+	ensure.Error(t, os.Rename(path, moved))
+	ensure.Error(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file not reopened after signal")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ensure.Write(t, lf, "line 3\n")
+	ensure.Error(t, lf.Close()) // NOTE: Also closes f.
+
+	ensure.File(t, moved, "line 1\nline 2\n")
+	ensure.File(t, path, "partial line 3\n")
+}
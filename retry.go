@@ -0,0 +1,162 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how a WriteCloser retries failed writes to its
+// underlying io.WriteCloser. See WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts to write a chunk of
+	// lines, including the initial attempt.
+	MaxAttempts int
+
+	// InitialBackoff is the duration to wait after the first failed attempt.
+	// When zero, 10 milliseconds is used.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum duration to wait between attempts. When
+	// zero, the backoff is not capped.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the backoff grows after each failed
+	// attempt. When zero, 2 is used.
+	Multiplier float64
+
+	// Jitter is the fraction, between 0 and 1, by which each backoff is
+	// randomly increased or decreased, so many writers do not retry in
+	// lockstep.
+	Jitter float64
+
+	// Retryable returns true when a write that failed with the error should
+	// be retried. When nil, IsRetryable is used.
+	Retryable func(error) bool
+}
+
+// IsRetryable returns true when err is a transient error for which a write
+// may succeed when retried: EAGAIN, EINTR, ENOSPC, or io.ErrShortWrite.
+func IsRetryable(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.ENOSPC) ||
+		errors.Is(err, io.ErrShortWrite)
+}
+
+// Validate returns an error when a field of the policy is outside its allowed
+// range. Packages that retry their own requests, such as esbulk and loki, use
+// it to validate the RetryPolicy in their options.
+func (rp *RetryPolicy) Validate() error {
+	if rp.MaxAttempts < 1 {
+		return fmt.Errorf("cannot use retry max attempts less than 1: %d", rp.MaxAttempts)
+	}
+	if rp.InitialBackoff < 0 {
+		return fmt.Errorf("cannot use retry initial backoff less than 0: %v", rp.InitialBackoff)
+	}
+	if rp.MaxBackoff < 0 {
+		return fmt.Errorf("cannot use retry max backoff less than 0: %v", rp.MaxBackoff)
+	}
+	if rp.Multiplier != 0 && rp.Multiplier < 1 {
+		return fmt.Errorf("cannot use retry multiplier less than 1: %v", rp.Multiplier)
+	}
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		return fmt.Errorf("cannot use retry jitter outside range 0 to 1: %v", rp.Jitter)
+	}
+	return nil
+}
+
+// withDefaults returns a copy of the policy, with the default value of each
+// field that is zero and has one.
+func (rp RetryPolicy) withDefaults() RetryPolicy {
+	if rp.InitialBackoff == 0 {
+		rp.InitialBackoff = 10 * time.Millisecond
+	}
+	if rp.Multiplier == 0 {
+		rp.Multiplier = 2
+	}
+	return rp
+}
+
+// Backoff returns the duration to wait after the specified failed attempt,
+// where the initial attempt is 1.
+func (rp *RetryPolicy) Backoff(attempt int) time.Duration {
+	p := rp.withDefaults()
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// retryable returns true when a write that failed with err should be retried.
+func (rp *RetryPolicy) retryable(err error) bool {
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// writeSink writes p to the underlying io.WriteCloser. When configured to
+// complete short writes, it immediately writes the remaining bytes of p after
+// each short write that made progress. When a retry policy is configured,
+// failed writes are retried with the bytes of p not yet written, so the
+// underlying io.WriteCloser receives the remainder of the same line rather
+// than a different line.
+func (lbf *WriteCloser) writeSink(p []byte) (int, error) {
+	var written int
+	for attempt := 1; ; {
+		nw, err := lbf.writeSinkOnce(p[written:])
+		written += nw
+		if lbf.completeShortWrites && written < len(p) {
+			if nw > 0 && (err == nil || errors.Is(err, io.ErrShortWrite)) {
+				continue // made progress, so not a failed attempt
+			}
+			if err == nil {
+				err = io.ErrShortWrite // no progress
+			}
+		}
+		if err == nil || lbf.retry == nil || attempt >= lbf.retry.MaxAttempts || !lbf.retry.retryable(err) {
+			return written, err
+		}
+		lbf.clock.Sleep(lbf.retry.Backoff(attempt))
+		attempt++
+	}
+}
+
+// writeSinkOnce writes p to the underlying io.WriteCloser, updating the
+// counters and the latency histogram, and invoking the slow flush callback
+// when the write is slow.
+func (lbf *WriteCloser) writeSinkOnce(p []byte) (int, error) {
+	started := lbf.clock.Now()
+	nw, err := lbf.iowc.Write(p)
+	elapsed := lbf.clock.Now().Sub(started)
+	lbf.latency.observe(elapsed)
+	if lbf.slowFlushCallback != nil && elapsed >= lbf.slowFlushThreshold {
+		lbf.slowFlushCallback(elapsed, nw, err)
+	}
+	if len(p) > 0 {
+		lbf.stats.Flushes++
+	}
+	if nw > 0 {
+		lbf.stats.BytesFlushed += uint64(nw)
+		lbf.stats.LinesWritten += uint64(bytes.Count(p[:nw], lbf.delimiter))
+	}
+	if err != nil {
+		lbf.stats.SinkErrors++
+	}
+	return nw, err
+}
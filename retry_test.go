@@ -0,0 +1,190 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyWriter returns the next error from errs, without writing, until errs
+// is exhausted, after which it writes to the underlying io.Writer.
+type flakyWriter struct {
+	io.Writer
+	errs []error
+}
+
+func (fw *flakyWriter) Write(p []byte) (int, error) {
+	if len(fw.errs) > 0 {
+		err := fw.errs[0]
+		fw.errs = fw.errs[1:]
+		return 0, err
+	}
+	return fw.Writer.Write(p)
+}
+
+func (fw *flakyWriter) Close() error { return nil }
+
+func ensureSleeps(tb testing.TB, clock *fakeClock, want ...time.Duration) {
+	tb.Helper()
+	if got := clock.Sleeps(); !reflect.DeepEqual(got, want) && (len(got) > 0 || len(want) > 0) {
+		tb.Errorf("SLEEPS: GOT: %v; WANT: %v", got, want)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{syscall.EAGAIN, true},
+		{syscall.EINTR, true},
+		{syscall.ENOSPC, true},
+		{&os.PathError{Op: "write", Path: "app.log", Err: syscall.ENOSPC}, true},
+		{fmt.Errorf("wrapped: %w", io.ErrShortWrite), true},
+		{syscall.EBADF, false},
+		{errWrite{}, false},
+	} {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%v: GOT: %v; WANT: %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Run("exponential with cap", func(t *testing.T) {
+		rp := &RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+		var got []time.Duration
+		for attempt := 1; attempt <= 5; attempt++ {
+			got = append(got, rp.Backoff(attempt))
+		}
+		want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		rp := &RetryPolicy{MaxAttempts: 3}
+		if got, want := rp.Backoff(2), 20*time.Millisecond; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		rp := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			if got := rp.Backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+				t.Fatalf("GOT: %v; WANT: between 50ms and 150ms", got)
+			}
+		}
+	})
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("option", func(t *testing.T) {
+		for _, tc := range []struct {
+			policy RetryPolicy
+			want   string
+		}{
+			{RetryPolicy{}, "max attempts"},
+			{RetryPolicy{MaxAttempts: 2, InitialBackoff: -1}, "initial backoff"},
+			{RetryPolicy{MaxAttempts: 2, MaxBackoff: -1}, "max backoff"},
+			{RetryPolicy{MaxAttempts: 2, Multiplier: 0.5}, "multiplier"},
+			{RetryPolicy{MaxAttempts: 2, Jitter: 2}, "jitter"},
+		} {
+			_, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithRetry(tc.policy))
+			ensureError(t, err, tc.want)
+		}
+
+		wc, err := NewWriteCloser(NopCloseWriter(io.Discard), 16, WithRetry(RetryPolicy{MaxAttempts: 2}))
+		ensureError(t, err)
+		if got, want := wc.retry.InitialBackoff, 10*time.Millisecond; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := wc.retry.Multiplier, 2.0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("transient errors", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		sink := &flakyWriter{Writer: output, errs: []error{syscall.EAGAIN, syscall.EINTR}}
+		wc, err := NewWriteCloser(sink, 1, WithClock(clock), WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\nline 2", wantState{
+			buf:                 "line 2",
+			n:                   13,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "line 1\n")
+		ensureSleeps(t, clock, time.Millisecond, 2*time.Millisecond)
+		if got, want := wc.Stats().SinkErrors, uint64(2); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("short writes continue with remainder of line", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 1, WithClock(clock), WithRetry(RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}))
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\nline 2\n", wantState{
+			n:                   14,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "line 1\nline 2\n")
+		ensureSleeps(t, clock, time.Millisecond, 2*time.Millisecond, 4*time.Millisecond)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 8, WithClock(clock), WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+
+		// Like any failed write, bytes of p not written are not retained.
+		ensureWriteResponse(t, wc, "line 2\n", wantState{
+			n:                   1,
+			indexOfFinalNewline: -1,
+			isShortWrite:        true,
+		})
+		ensureBuffer(t, output, "line 1\nl")
+		ensureSleeps(t, clock, time.Millisecond)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		clock := newFakeClock()
+		wc, err := NewWriteCloser(&errOnWrite{}, 1, WithClock(clock), WithRetry(RetryPolicy{MaxAttempts: 5}))
+		ensureError(t, err)
+
+		_, err = wc.Write([]byte("line 1\n"))
+		ensureError(t, err, "test write error")
+		ensureSleeps(t, clock)
+	})
+
+	t.Run("custom classification", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		sink := &flakyWriter{Writer: output, errs: []error{errWrite{}}}
+		wc, err := NewWriteCloser(sink, 1, WithClock(clock), WithRetry(RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Second,
+			Retryable:      func(err error) bool { return errors.As(err, new(errWrite)) },
+		}))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		ensureBuffer(t, output, "line 1\n")
+		ensureSleeps(t, clock, time.Second)
+	})
+}
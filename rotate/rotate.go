@@ -0,0 +1,437 @@
+// Package rotate provides a file that rotates based on its size and age. It is
+// designed to be the underlying io.WriteCloser of a golfw.WriteCloser, which
+// only hands it complete lines, so the file is only ever rotated on a line
+// boundary.
+//
+//     func Example() error {
+//         rf, err := rotate.New("app.log", &rotate.Options{
+//             MaxSize:    100 << 20,
+//             MaxAge:     24 * time.Hour,
+//             MaxBackups: 7,
+//             Compress:   true,
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(rf, 16384)
+//         if err != nil {
+//             _ = rf.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes rf.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the layout of the timestamp inserted into the name of a
+// rotated file. It sorts lexically in chronological order.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+const compressSuffix = ".gz"
+
+// Options configures a File.
+type Options struct {
+	// MaxSize is the maximum size in bytes of the file. When a write would
+	// cause the file to exceed this size, the file is rotated prior to the
+	// write. A single write larger than MaxSize is written to its own file.
+	// When zero, the file is not rotated based on its size.
+	MaxSize int64
+
+	// MaxAge is the maximum duration a file is written to before it is
+	// rotated. When zero, the file is not rotated based on its age. It does
+	// not cause rotated files to be removed. See MaxBackupAge.
+	MaxAge time.Duration
+
+	// MaxBackups is the maximum number of rotated files to retain. When zero,
+	// all rotated files are retained.
+	MaxBackups int
+
+	// MaxBackupAge is the maximum duration to retain a rotated file, based on
+	// the timestamp in its name. When zero, rotated files are not removed
+	// based on their age.
+	MaxBackupAge time.Duration
+
+	// Compress causes rotated files to be compressed with gzip.
+	Compress bool
+
+	// Perm is the permission bits used when creating a file. When zero, 0644
+	// is used.
+	Perm os.FileMode
+
+	// OnError, when not nil, is invoked with each error from compressing or
+	// removing rotated files. Because those run in a background goroutine
+	// after the file is rotated, their errors are not returned by Write or
+	// Rotate. It is also invoked when Write cannot rotate the file but
+	// continues writing to it.
+	OnError func(error)
+}
+
+// File is an io.WriteCloser that writes to a file, rotating it based on its
+// size and age. Rotated files are renamed by inserting a timestamp between the
+// base name and the extension of the file, for instance app.log is rotated to
+// app-2022-03-05T12-00-00.000.log. Its methods are safe to invoke from multiple
+// goroutines.
+type File struct {
+	lock     sync.Mutex
+	path     string
+	options  Options
+	fh       *os.File // nil after a rotation that could not open a new file
+	closed   bool
+	size     int64     // number of bytes in current file
+	opened   time.Time // when current file was opened, for MaxAge
+	now      func() time.Time
+	openFile func(name string, flag int, perm os.FileMode) (*os.File, error)
+	mill     chan time.Time // rotation times, for compressing and pruning
+	milled   chan struct{}  // closed when mill goroutine returns
+}
+
+// New returns a File that writes to the specified path, appending to the file
+// when it already exists. When options is nil, the file is never rotated
+// except by invoking Rotate.
+func New(path string, options *Options) (*File, error) {
+	f := &File{path: path, now: time.Now, openFile: os.OpenFile}
+	if options != nil {
+		f.options = *options
+	}
+	if f.options.MaxSize < 0 {
+		return nil, fmt.Errorf("cannot create File when MaxSize less than 0: %d", f.options.MaxSize)
+	}
+	if f.options.MaxAge < 0 {
+		return nil, fmt.Errorf("cannot create File when MaxAge less than 0: %v", f.options.MaxAge)
+	}
+	if f.options.MaxBackups < 0 {
+		return nil, fmt.Errorf("cannot create File when MaxBackups less than 0: %d", f.options.MaxBackups)
+	}
+	if f.options.MaxBackupAge < 0 {
+		return nil, fmt.Errorf("cannot create File when MaxBackupAge less than 0: %v", f.options.MaxBackupAge)
+	}
+	if f.options.Perm == 0 {
+		f.options.Perm = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file for appending, creating it when necessary.
+func (f *File) open() error {
+	fh, err := f.openFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, f.options.Perm)
+	if err != nil {
+		return err
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		_ = fh.Close()
+		return err
+	}
+	f.fh = fh
+	f.size = fi.Size()
+	f.opened = f.now()
+	return nil
+}
+
+// Write writes p to the file, first rotating the file when writing p would
+// cause the file to exceed MaxSize, or when the file is older than MaxAge.
+// Because p is never split across two files, when p is a sequence of complete
+// lines, every line is written to exactly one file. When a previous rotation
+// renamed the file but could not open a new one, Write first tries again to
+// open it.
+func (f *File) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.fh == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			if f.fh == nil {
+				return 0, err
+			}
+			// Could not rename the file, but it is still open, so rather
+			// than losing p, report the error and keep writing to it.
+			f.report(err)
+		}
+	}
+	n, err := f.fh.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// shouldRotate returns true when writing the specified number of bytes would
+// cause the file to exceed MaxSize, or when the file is older than MaxAge.
+func (f *File) shouldRotate(n int) bool {
+	if f.options.MaxSize > 0 && f.size+int64(n) > f.options.MaxSize {
+		return true
+	}
+	return f.options.MaxAge > 0 && f.now().Sub(f.opened) >= f.options.MaxAge
+}
+
+// Rotate closes and renames the file, then opens a new file at the original
+// path. Rotated files are compressed and old rotated files are removed, as
+// configured, by a background goroutine, so neither Rotate nor Write waits
+// for them. When a previous rotation renamed the file but could not open a new
+// one, Rotate only tries again to open it.
+func (f *File) Rotate() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.fh == nil {
+		return f.open()
+	}
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	if err := f.fh.Close(); err != nil {
+		return err
+	}
+	f.fh = nil
+
+	backup, err := f.backupName()
+	if err == nil {
+		err = os.Rename(f.path, backup)
+	}
+	if err != nil {
+		_ = f.open() // continue writing to the file that could not be renamed
+		return err
+	}
+	if f.options.Compress || f.options.MaxBackups > 0 || f.options.MaxBackupAge > 0 {
+		if f.mill == nil {
+			f.mill = make(chan time.Time, 1)
+			f.milled = make(chan struct{})
+			go f.runMill(f.mill, f.milled)
+		}
+		select {
+		case f.mill <- f.now():
+		default:
+			// The mill has yet to handle the previous rotation, and will
+			// handle this rotated file along with it.
+		}
+	}
+	// When the new file cannot be opened, fh remains nil, and the next Write
+	// or Rotate tries again to open it.
+	return f.open()
+}
+
+// runMill compresses rotated files and removes old rotated files after each
+// rotation, until mill is closed.
+func (f *File) runMill(mill <-chan time.Time, milled chan<- struct{}) {
+	defer close(milled)
+	for now := range mill {
+		if err := f.compressBackups(); err != nil {
+			f.report(err)
+		}
+		if err := f.prune(now); err != nil {
+			f.report(err)
+		}
+	}
+}
+
+func (f *File) report(err error) {
+	if f.options.OnError != nil {
+		f.options.OnError(err)
+	}
+}
+
+// compressBackups compresses every rotated file that is not yet compressed,
+// continuing past those that cannot be compressed.
+func (f *File) compressBackups() error {
+	if !f.options.Compress {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range backups {
+		if strings.HasSuffix(name, compressSuffix) {
+			continue
+		}
+		if err = compress(name, f.options.Perm); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backupName returns the name to which the file is renamed when rotated,
+// which neither exists itself nor as a compressed file.
+func (f *File) backupName() (string, error) {
+	dir, prefix, ext := f.split()
+	when := f.now()
+	for {
+		name := filepath.Join(dir, prefix+when.Format(backupTimeFormat)+ext)
+		_, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			_, err = os.Stat(name + compressSuffix)
+			if os.IsNotExist(err) {
+				return name, nil
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		when = when.Add(time.Millisecond)
+	}
+}
+
+// split returns the directory of the file, the prefix of the name of its
+// rotated files, and its extension.
+func (f *File) split() (string, string, string) {
+	dir, base := filepath.Split(f.path)
+	ext := filepath.Ext(base)
+	return dir, base[:len(base)-len(ext)] + "-", ext
+}
+
+// prune removes the oldest rotated files when there are more than MaxBackups,
+// and rotated files whose timestamps are more than MaxBackupAge before now.
+func (f *File) prune(now time.Time) error {
+	if f.options.MaxBackups == 0 && f.options.MaxBackupAge == 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	var remove int // number of oldest backups to remove
+	if f.options.MaxBackups > 0 && len(backups) > f.options.MaxBackups {
+		remove = len(backups) - f.options.MaxBackups
+	}
+	if f.options.MaxBackupAge > 0 {
+		_, prefix, _ := f.split()
+		cutoff := now.Add(-f.options.MaxBackupAge)
+		for remove < len(backups) {
+			name := filepath.Base(backups[remove])
+			when, err := time.ParseInLocation(backupTimeFormat, name[len(prefix):len(prefix)+len(backupTimeFormat)], now.Location())
+			if err != nil || !when.Before(cutoff) {
+				break
+			}
+			remove++
+		}
+	}
+	for _, name := range backups[:remove] {
+		if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// backups returns the pathnames of rotated files, oldest first.
+func (f *File) backups() ([]string, error) {
+	dir, prefix, ext := f.split()
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(name[len(prefix):], compressSuffix)
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		stamp = stamp[:len(stamp)-len(ext)]
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue // not a rotated file
+		}
+		backups = append(backups, name)
+	}
+	// Timestamps sort lexically in chronological order, but the names of
+	// compressed files are longer, so sort by timestamp alone.
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i][len(prefix):len(prefix)+len(backupTimeFormat)] < backups[j][len(prefix):len(prefix)+len(backupTimeFormat)]
+	})
+	for i, name := range backups {
+		backups[i] = filepath.Join(dir, name)
+	}
+	return backups, nil
+}
+
+// compress writes a gzip compressed copy of the specified file, then removes
+// the original.
+func compress(name string, perm os.FileMode) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err2 := zw.Close(); err == nil {
+		err = err2
+	}
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(name + compressSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Close closes the file, then waits for the background goroutine to finish
+// compressing and removing rotated files. It does not rotate the file.
+func (f *File) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	var err error
+	if f.fh != nil {
+		err = f.fh.Close()
+		f.fh = nil
+	}
+	if f.mill != nil {
+		close(f.mill)
+		<-f.milled
+		f.mill = nil
+	}
+	return err
+}
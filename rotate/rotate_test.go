@@ -0,0 +1,327 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+func ensureCompressedFile(tb testing.TB, name, want string) {
+	tb.Helper()
+	fh, err := os.Open(name)
+	ensure.Error(tb, err)
+	defer fh.Close()
+	zr, err := gzip.NewReader(fh)
+	ensure.Error(tb, err)
+	buf, err := io.ReadAll(zr)
+	ensure.Error(tb, err)
+	if got := string(buf); got != want {
+		tb.Errorf("%s: GOT: %q; WANT: %q", filepath.Base(name), got, want)
+	}
+}
+
+// newTestFile returns a File whose clock only advances when the returned
+// function is invoked.
+func newTestFile(tb testing.TB, path string, options *Options) (*File, func(time.Duration)) {
+	tb.Helper()
+	f, err := New(path, options)
+	ensure.Error(tb, err)
+	when := time.Date(2022, time.March, 5, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return when }
+	f.opened = when
+	return f, func(d time.Duration) { when = when.Add(d) }
+}
+
+func ensureBackups(tb testing.TB, f *File, want ...string) []string {
+	tb.Helper()
+	backups, err := f.backups()
+	ensure.Error(tb, err)
+	if got, want := len(backups), len(want); got != want {
+		tb.Fatalf("BACKUPS: GOT: %v; WANT: %v", backups, want)
+	}
+	for i, name := range backups {
+		if got, want := filepath.Base(name), want[i]; got != want {
+			tb.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	}
+	return backups
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := New(filepath.Join(dir, "app.log"), &Options{MaxSize: -1})
+	ensure.Error(t, err, "MaxSize")
+	_, err = New(filepath.Join(dir, "app.log"), &Options{MaxAge: -1})
+	ensure.Error(t, err, "MaxAge")
+	_, err = New(filepath.Join(dir, "app.log"), &Options{MaxBackups: -1})
+	ensure.Error(t, err, "MaxBackups")
+	_, err = New(filepath.Join(dir, "app.log"), &Options{MaxBackupAge: -1})
+	ensure.Error(t, err, "MaxBackupAge")
+
+	t.Run("creates directory and appends", func(t *testing.T) {
+		path := filepath.Join(dir, "sub", "app.log")
+		f, err := New(path, nil)
+		ensure.Error(t, err)
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, f.Close())
+
+		f, err = New(path, &Options{MaxSize: 10})
+		ensure.Error(t, err)
+		if got, want := f.size, int64(7); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensure.Write(t, f, "2\n")
+		ensure.Error(t, f.Close())
+		ensure.File(t, path, "line 1\n2\n")
+	})
+}
+
+func TestFile(t *testing.T) {
+	t.Run("max size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, advance := newTestFile(t, path, &Options{MaxSize: 12})
+
+		ensure.Write(t, f, "line 1\n")
+		advance(time.Second)
+		ensure.Write(t, f, "line 2\n") // would exceed
+		advance(time.Second)
+		ensure.Write(t, f, "line 3\nline 4\n")
+		advance(time.Second)
+		ensure.Write(t, f, "this line is larger than MaxSize\n")
+		ensure.Error(t, f.Close())
+
+		backups := ensureBackups(t, f,
+			"app-2022-03-05T12-00-01.000.log",
+			"app-2022-03-05T12-00-02.000.log",
+			"app-2022-03-05T12-00-03.000.log",
+		)
+		ensure.File(t, backups[0], "line 1\n")
+		ensure.File(t, backups[1], "line 2\n")
+		ensure.File(t, backups[2], "line 3\nline 4\n")
+		ensure.File(t, path, "this line is larger than MaxSize\n")
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, advance := newTestFile(t, path, &Options{MaxAge: time.Minute})
+
+		ensure.Write(t, f, "line 1\n")
+		advance(59 * time.Second)
+		ensure.Write(t, f, "line 2\n")
+		advance(time.Second)
+		ensure.Write(t, f, "line 3\n") // rotates
+		advance(59 * time.Second)
+		ensure.Write(t, f, "line 4\n")
+		ensure.Error(t, f.Close())
+
+		backups := ensureBackups(t, f, "app-2022-03-05T12-01-00.000.log")
+		ensure.File(t, backups[0], "line 1\nline 2\n")
+		ensure.File(t, path, "line 3\nline 4\n")
+	})
+
+	t.Run("empty file is not rotated by size or age", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, advance := newTestFile(t, path, &Options{MaxSize: 4, MaxAge: time.Second})
+
+		advance(time.Minute)
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, f.Close())
+		ensureBackups(t, f)
+		ensure.File(t, path, "line 1\n")
+	})
+
+	t.Run("max backups", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, advance := newTestFile(t, path, &Options{MaxSize: 7, MaxBackups: 2})
+
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+			advance(time.Second)
+			ensure.Write(t, f, line)
+		}
+		ensure.Error(t, f.Close())
+
+		backups := ensureBackups(t, f,
+			"app-2022-03-05T12-00-03.000.log",
+			"app-2022-03-05T12-00-04.000.log",
+		)
+		ensure.File(t, backups[0], "line 2\n")
+		ensure.File(t, backups[1], "line 3\n")
+		ensure.File(t, path, "line 4\n")
+	})
+
+	t.Run("compress", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, advance := newTestFile(t, path, &Options{Compress: true, MaxBackups: 1})
+
+		ensure.Write(t, f, "line 1\n")
+		advance(time.Second)
+		ensure.Error(t, f.Rotate())
+		ensure.Write(t, f, "line 2\n")
+		advance(time.Second)
+		ensure.Error(t, f.Rotate())
+		ensure.Write(t, f, "line 3\n")
+		ensure.Error(t, f.Close())
+
+		backups := ensureBackups(t, f, "app-2022-03-05T12-00-02.000.log.gz")
+		ensureCompressedFile(t, backups[0], "line 2\n")
+		ensure.File(t, path, "line 3\n")
+	})
+
+	t.Run("compress error is reported and does not lose writes", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		stale := filepath.Join(dir, "app-2022-03-05T11-00-00.000.log")
+		ensure.Error(t, os.WriteFile(stale, []byte("line 0\n"), 0644))
+		ensure.Error(t, os.Mkdir(stale+".gz", 0755)) // prevents compressing stale
+
+		var errs []error
+		f, advance := newTestFile(t, path, &Options{
+			MaxSize:  7,
+			Compress: true,
+			OnError:  func(err error) { errs = append(errs, err) },
+		})
+		ensure.Write(t, f, "line 1\n")
+		advance(time.Second)
+		ensure.Write(t, f, "line 2\n") // rotates
+		ensure.Error(t, f.Close())
+
+		if got, want := len(errs), 1; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", errs, want)
+		}
+		ensure.Error(t, errs[0], "exists")
+		backups := ensureBackups(t, f,
+			"app-2022-03-05T11-00-00.000.log",
+			"app-2022-03-05T12-00-01.000.log.gz",
+		)
+		ensure.File(t, backups[0], "line 0\n")
+		ensureCompressedFile(t, backups[1], "line 1\n")
+		ensure.File(t, path, "line 2\n")
+	})
+
+	t.Run("max backup age", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		for _, name := range []string{"app-2022-03-04T11-00-00.000.log", "app-2022-03-04T13-00-00.000.log.gz"} {
+			ensure.Error(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+		}
+		f, advance := newTestFile(t, path, &Options{MaxBackupAge: 24 * time.Hour})
+
+		ensure.Write(t, f, "line 1\n")
+		advance(time.Second)
+		ensure.Error(t, f.Rotate())
+		ensure.Error(t, f.Close())
+
+		ensureBackups(t, f,
+			"app-2022-03-04T13-00-00.000.log.gz",
+			"app-2022-03-05T12-00-01.000.log",
+		)
+	})
+
+	t.Run("rotate avoids existing names", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, _ := newTestFile(t, path, &Options{Compress: true})
+
+		ensure.Write(t, f, "line 1\n")
+		ensure.Error(t, f.Rotate())
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Rotate())
+		ensure.Error(t, f.Close())
+
+		backups := ensureBackups(t, f,
+			"app-2022-03-05T12-00-00.000.log.gz",
+			"app-2022-03-05T12-00-00.001.log.gz",
+		)
+		ensureCompressedFile(t, backups[0], "line 1\n")
+		ensureCompressedFile(t, backups[1], "line 2\n")
+		ensure.File(t, path, "")
+	})
+
+	t.Run("ignores unrelated files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		for _, name := range []string{"app-notes.log", "app-2022-03-05T11-00-00.000.txt", "other-2022-03-05T11-00-00.000.log"} {
+			ensure.Error(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+		}
+		f, _ := newTestFile(t, path, &Options{MaxBackups: 1})
+		ensure.Error(t, f.Rotate())
+		ensure.Error(t, f.Close())
+		ensureBackups(t, f, "app-2022-03-05T12-00-00.000.log")
+		for _, name := range []string{"app-notes.log", "app-2022-03-05T11-00-00.000.txt", "other-2022-03-05T11-00-00.000.log"} {
+			ensure.File(t, filepath.Join(dir, name), "")
+		}
+	})
+
+	t.Run("open error after rename is retried by next write", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		f, advance := newTestFile(t, path, &Options{MaxSize: 12})
+		f.openFile = func(string, int, os.FileMode) (*os.File, error) {
+			return nil, errors.New("test open error")
+		}
+
+		ensure.Write(t, f, "line 1\n")
+		advance(time.Second)
+		_, err := f.Write([]byte("line 2\n"))
+		ensure.Error(t, err, "test open error")
+		_, err = f.Write([]byte("line 2\n"))
+		ensure.Error(t, err, "test open error")
+
+		f.openFile = os.OpenFile
+		ensure.Write(t, f, "line 2\n")
+		ensure.Error(t, f.Close())
+
+		backups := ensureBackups(t, f, "app-2022-03-05T12-00-01.000.log")
+		ensure.File(t, backups[0], "line 1\n")
+		ensure.File(t, path, "line 2\n")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, _ := newTestFile(t, filepath.Join(t.TempDir(), "app.log"), nil)
+		ensure.Error(t, f.Close())
+		_, err := f.Write([]byte("line 1\n"))
+		ensure.Error(t, err, os.ErrClosed.Error())
+		ensure.Error(t, f.Rotate(), os.ErrClosed.Error())
+		ensure.Error(t, f.Close(), os.ErrClosed.Error())
+	})
+}
+
+func TestWithWriteCloser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, _ := newTestFile(t, path, &Options{MaxSize: 32})
+
+	lf, err := golfw.NewWriteCloser(f, 16)
+	ensure.Error(t, err)
+	for i := 0; i < 20; i++ {
+		ensure.Write(t, lf, "line ")
+		ensure.Write(t, lf, "of text\n")
+	}
+	ensure.Error(t, lf.Close())
+
+	backups, err := f.backups()
+	ensure.Error(t, err)
+	var total int
+	for _, name := range append(backups, path) {
+		buf, err := os.ReadFile(name)
+		ensure.Error(t, err)
+		if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+			t.Errorf("%s: file does not end on line boundary: %q", filepath.Base(name), buf)
+		}
+		for _, line := range strings.SplitAfter(string(buf), "\n") {
+			if line != "" && line != "line of text\n" {
+				t.Errorf("%s: torn line: %q", filepath.Base(name), line)
+			}
+		}
+		total += strings.Count(string(buf), "\n")
+	}
+	if got, want := total, 20; got != want {
+		t.Errorf("GOT: %v; WANT: %v", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package golfw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// Route sends the lines that match it to a sink. See Router.
+type Route struct {
+	// Match returns true when the line should be written to Writer. The line
+	// does not include its delimiter, and is only valid for the duration of
+	// the call.
+	Match func(line []byte) bool
+
+	// Writer is the sink. More than one Route may share the same Writer, in
+	// which case the lines of each chunk routed to it are written to it with
+	// a single write, in their original order. Writers are shared when they
+	// are equal by ==, so a Writer whose type is not comparable, such as a
+	// struct with a slice field, is never shared.
+	Writer io.WriteCloser
+}
+
+// MatchRegexp returns a Match function for a Route that matches lines
+// containing a match of re.
+func MatchRegexp(re *regexp.Regexp) func([]byte) bool {
+	return re.Match
+}
+
+// RouterOptions configures a Router.
+type RouterOptions struct {
+	// Delimiter is the record delimiter of the chunks written to the Router.
+	// When empty, LF is used.
+	Delimiter []byte
+}
+
+// routerSink is a distinct sink of a Router, along with the buffer in which
+// the lines of a chunk routed to it are accumulated.
+type routerSink struct {
+	iowc io.WriteCloser
+	buf  []byte
+}
+
+// Router is an io.WriteCloser that splits each chunk written to it into lines,
+// and writes each line to the sink of the first Route that matches it, or to
+// its fallback sink when no Route matches it. Lines are copied into a buffer
+// for each sink, which is reused for every chunk, so routing does not allocate
+// once the buffers have grown to the size of the chunks. Its methods are safe
+// to invoke from multiple goroutines.
+//
+// It is designed to be the underlying io.WriteCloser of a WriteCloser, which
+// only hands it chunks of complete lines.
+//
+//     func Example(alerts, main *os.File) error {
+//         router, err := golfw.NewRouter([]golfw.Route{
+//             {Match: golfw.MatchRegexp(regexp.MustCompile(`\blevel=error\b`)), Writer: alerts},
+//         }, main, nil)
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(router, 16384)
+//         if err != nil {
+//             _ = router.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes alerts and main.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+type Router struct {
+	lock      sync.Mutex
+	matchers  []func([]byte) bool
+	targets   []int // index of sink for each matcher
+	fallback  int   // index of fallback sink, or -1 to discard
+	sinks     []routerSink
+	delimiter []byte
+	closed    bool
+}
+
+// NewRouter returns a Router that writes each line to the sink of the first
+// of routes that matches it, or to fallback when none match. When fallback is
+// nil, lines that match no Route are discarded. When options is nil, the
+// defaults described by RouterOptions are used.
+func NewRouter(routes []Route, fallback io.WriteCloser, options *RouterOptions) (*Router, error) {
+	r := &Router{fallback: -1, delimiter: []byte{'\n'}}
+	if options != nil && len(options.Delimiter) > 0 {
+		r.delimiter = append([]byte(nil), options.Delimiter...)
+	}
+	for i, route := range routes {
+		if route.Match == nil {
+			return nil, fmt.Errorf("cannot create Router when route %d has nil Match", i)
+		}
+		if route.Writer == nil {
+			return nil, fmt.Errorf("cannot create Router when route %d has nil Writer", i)
+		}
+		r.matchers = append(r.matchers, route.Match)
+		r.targets = append(r.targets, r.sinkIndex(route.Writer))
+	}
+	if fallback != nil {
+		r.fallback = r.sinkIndex(fallback)
+	}
+	return r, nil
+}
+
+// sinkIndex returns the index of the sink for iowc, adding it when it is not
+// already a sink.
+func (r *Router) sinkIndex(iowc io.WriteCloser) int {
+	// Comparing interface values holding the same type that is not
+	// comparable panics.
+	if reflect.TypeOf(iowc).Comparable() {
+		for i := range r.sinks {
+			if r.sinks[i].iowc == iowc {
+				return i
+			}
+		}
+	}
+	r.sinks = append(r.sinks, routerSink{iowc: iowc})
+	return len(r.sinks) - 1
+}
+
+// route returns the index of the sink for line, or -1 when it is discarded.
+func (r *Router) route(line []byte) int {
+	for i, match := range r.matchers {
+		if match(line) {
+			return r.targets[i]
+		}
+	}
+	return r.fallback
+}
+
+// Write routes each line of p to its sink, then writes the lines routed to each
+// sink with a single write. Final bytes of p without a trailing delimiter are
+// routed as a line. Because each line is written at most once, Write reports
+// all of p as written even when it returns an error. The returned error joins
+// the errors from every sink that failed.
+func (r *Router) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+
+	_ = EachLine(p, r.delimiter, func(line, raw []byte) error {
+		if s := r.route(line); s >= 0 {
+			r.sinks[s].buf = append(r.sinks[s].buf, raw...)
+		}
+		return nil
+	})
+
+	var errs []error
+	for i := range r.sinks {
+		sink := &r.sinks[i]
+		if len(sink.buf) == 0 {
+			continue
+		}
+		nw, err := sink.iowc.Write(sink.buf)
+		if err == nil && nw < len(sink.buf) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+		sink.buf = sink.buf[:0]
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// Close closes every sink once, and returns the errors from closing them
+// joined by errors.Join.
+func (r *Router) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	r.closed = true
+
+	var errs []error
+	for i := range r.sinks {
+		if err := r.sinks[i].iowc.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+		r.sinks[i].buf = nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package golfw
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"testing"
+)
+
+// uncomparableSink is an io.WriteCloser whose values panic when compared.
+type uncomparableSink struct{ bufs []*bytes.Buffer }
+
+func (us uncomparableSink) Write(p []byte) (int, error) { return us.bufs[0].Write(p) }
+func (uncomparableSink) Close() error                   { return nil }
+
+func TestRouter(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewRouter([]Route{{Writer: NopCloseWriter(new(bytes.Buffer))}}, nil, nil)
+		ensureError(t, err, "nil Match")
+		_, err = NewRouter([]Route{{Match: func([]byte) bool { return true }}}, nil, nil)
+		ensureError(t, err, "nil Writer")
+	})
+
+	t.Run("routes lines", func(t *testing.T) {
+		alerts := new(bytes.Buffer)
+		main := new(bytes.Buffer)
+		var lines []string
+		router, err := NewRouter([]Route{
+			{Match: func(line []byte) bool { lines = append(lines, string(line)); return false }, Writer: NopCloseWriter(new(bytes.Buffer))},
+			{Match: MatchRegexp(regexp.MustCompile(`\blevel=error\b`)), Writer: NopCloseWriter(alerts)},
+		}, NopCloseWriter(main), nil)
+		ensureError(t, err)
+		wc, err := NewWriteCloser(router, 64)
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "level=info a\nlevel=error b\nlevel=info c\nlevel=error d\n")
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, alerts, "level=error b\nlevel=error d\n")
+		ensureBuffer(t, main, "level=info a\nlevel=info c\n")
+		if got, want := len(lines), 4; got != want {
+			t.Fatalf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := lines[0], "level=info a"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+
+		ensureWrite(t, wc, "level=error e")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, alerts, "level=error b\nlevel=error d\nlevel=error e")
+	})
+
+	t.Run("shared sink preserves order", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		sink := NopCloseWriter(output)
+		router, err := NewRouter([]Route{
+			{Match: func(line []byte) bool { return bytes.HasPrefix(line, []byte("a")) }, Writer: sink},
+			{Match: func(line []byte) bool { return bytes.HasPrefix(line, []byte("b")) }, Writer: sink},
+		}, nil, &RouterOptions{Delimiter: []byte("\r\n")})
+		ensureError(t, err)
+
+		_, err = router.Write([]byte("b1\r\na1\r\nc1\r\nb2\r\n"))
+		ensureError(t, err)
+		ensureBuffer(t, output, "b1\r\na1\r\nb2\r\n")
+	})
+
+	t.Run("uncomparable sinks", func(t *testing.T) {
+		a := new(bytes.Buffer)
+		b := new(bytes.Buffer)
+		router, err := NewRouter([]Route{
+			{Match: func(line []byte) bool { return bytes.HasPrefix(line, []byte("a")) }, Writer: uncomparableSink{[]*bytes.Buffer{a}}},
+		}, uncomparableSink{[]*bytes.Buffer{b}}, nil)
+		ensureError(t, err)
+
+		_, err = router.Write([]byte("a1\nb1\n"))
+		ensureError(t, err)
+		ensureBuffer(t, a, "a1\n")
+		ensureBuffer(t, b, "b1\n")
+	})
+
+	t.Run("sink errors", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		router, err := NewRouter([]Route{
+			{Match: func(line []byte) bool { return bytes.HasPrefix(line, []byte("a")) }, Writer: &errOnWrite{}},
+		}, NopCloseWriter(output), nil)
+		ensureError(t, err)
+
+		n, err := router.Write([]byte("a1\nb1\n"))
+		ensureError(t, err, "sink 0: test write error")
+		if got, want := n, 6; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureBuffer(t, output, "b1\n")
+		ensureError(t, router.Close(), "sink 0: test close error")
+		ensureError(t, router.Close(), "closed")
+	})
+
+	t.Run("does not allocate per line", func(t *testing.T) {
+		router, err := NewRouter([]Route{
+			{Match: func(line []byte) bool { return bytes.Contains(line, []byte("error")) }, Writer: NopCloseWriter(io.Discard)},
+		}, NopCloseWriter(io.Discard), nil)
+		ensureError(t, err)
+		chunk := bytes.Repeat([]byte("level=info message\nlevel=error message\n"), 100)
+
+		_, _ = router.Write(chunk) // grow buffers
+		allocs := testing.AllocsPerRun(100, func() { _, _ = router.Write(chunk) })
+		if allocs > 0 {
+			t.Errorf("GOT: %v; WANT: %v", allocs, 0)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package golfw
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxOpen is the maximum number of shards a Sharder keeps open when
+// ShardOptions does not specify one.
+const DefaultMaxOpen = 64
+
+// ShardOptions configures a Sharder.
+type ShardOptions struct {
+	// Key returns the key of each line, for instance LogfmtKey("tenant").
+	// Required.
+	Key KeyFunc
+
+	// Open opens the writer for the shard with the specified name. When
+	// Shards is zero, the name is the key itself, so Open must not trust it,
+	// for instance to be a safe file name. See ShardFiles. Required.
+	Open func(name string) (io.WriteCloser, error)
+
+	// Shards is the number of shards into which keys are hashed. The name of
+	// each shard is its decimal index. When zero, each key is its own shard.
+	Shards int
+
+	// DefaultKey is the key of lines for which Key returns an empty key.
+	DefaultKey string
+
+	// MaxOpen is the maximum number of shards kept open. When opening a shard
+	// would exceed it, the least recently used shard is closed. When zero,
+	// DefaultMaxOpen is used.
+	MaxOpen int
+
+	// Delimiter is the record delimiter of the chunks written to the Sharder.
+	// When empty, LF is used.
+	Delimiter []byte
+}
+
+// shard is an open shard of a Sharder, along with the buffer in which the lines
+// of a chunk routed to it are accumulated.
+type shard struct {
+	name string
+	iowc io.WriteCloser
+	err  error // error opening shard, reported once by Write
+	buf  []byte
+}
+
+// Sharder is an io.WriteCloser that splits each chunk written to it into lines,
+// extracts a key from each line, and writes each line to the shard for its
+// key. It keeps at most MaxOpen shards open, closing the least recently used
+// shard when it needs to open another. Its methods are safe to invoke from
+// multiple goroutines.
+//
+// It is designed to be the underlying io.WriteCloser of a WriteCloser, which
+// only hands it chunks of complete lines, so each shard only ever receives
+// whole lines.
+//
+//     func Example() error {
+//         sharder, err := golfw.NewSharder(golfw.ShardOptions{
+//             Key:        golfw.LogfmtKey("tenant"),
+//             Open:       golfw.ShardFiles("/var/log/tenants", ".log", 0644),
+//             DefaultKey: "unknown",
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(sharder, 16384)
+//         if err != nil {
+//             _ = sharder.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes every open shard.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+type Sharder struct {
+	lock       sync.Mutex
+	options    ShardOptions
+	names      []string // name of each hashed shard
+	defaultKey []byte
+	shards     map[string]*list.Element
+	lru        *list.List // of *shard, most recently used first
+	closed     bool
+}
+
+// NewSharder returns a Sharder configured by options.
+func NewSharder(options ShardOptions) (*Sharder, error) {
+	if options.Key == nil {
+		return nil, errors.New("cannot create Sharder when Key is nil")
+	}
+	if options.Open == nil {
+		return nil, errors.New("cannot create Sharder when Open is nil")
+	}
+	if options.Shards < 0 {
+		return nil, fmt.Errorf("cannot create Sharder when Shards less than 0: %d", options.Shards)
+	}
+	if options.MaxOpen < 0 {
+		return nil, fmt.Errorf("cannot create Sharder when MaxOpen less than 0: %d", options.MaxOpen)
+	}
+	if options.MaxOpen == 0 {
+		options.MaxOpen = DefaultMaxOpen
+	}
+	if len(options.Delimiter) == 0 {
+		options.Delimiter = []byte{'\n'}
+	}
+	s := &Sharder{
+		options:    options,
+		defaultKey: []byte(options.DefaultKey),
+		shards:     make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+	for i := 0; i < options.Shards; i++ {
+		s.names = append(s.names, strconv.Itoa(i))
+	}
+	return s, nil
+}
+
+// ShardFiles returns an Open function for ShardOptions that opens, for
+// appending, the file in dir named by the shard name followed by ext. It
+// rejects names that are empty, or that would refer to a file outside of dir.
+func ShardFiles(dir, ext string, perm os.FileMode) func(string) (io.WriteCloser, error) {
+	return func(name string) (io.WriteCloser, error) {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+			return nil, fmt.Errorf("cannot use invalid shard name: %q", name)
+		}
+		return os.OpenFile(filepath.Join(dir, name+ext), os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm)
+	}
+}
+
+// fnv32a returns the 32-bit FNV-1a hash of key.
+func fnv32a(key []byte) uint32 {
+	h := uint32(2166136261)
+	for _, b := range key {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return h
+}
+
+// shard returns the shard for key, opening it when necessary. The returned
+// error is from evicting the least recently used shard to make room for it.
+func (s *Sharder) shard(key []byte) (*shard, error) {
+	var name string
+	var elem *list.Element
+	if s.options.Shards > 0 {
+		name = s.names[fnv32a(key)%uint32(s.options.Shards)]
+		elem = s.shards[name]
+	} else {
+		elem = s.shards[string(key)] // does not allocate
+	}
+	if elem != nil {
+		s.lru.MoveToFront(elem)
+		return elem.Value.(*shard), nil
+	}
+	if s.options.Shards == 0 {
+		name = string(key)
+	}
+
+	var err error
+	if s.lru.Len() >= s.options.MaxOpen {
+		err = s.evict(s.lru.Back())
+	}
+	sh := &shard{name: name}
+	sh.iowc, sh.err = s.options.Open(name)
+	s.shards[name] = s.lru.PushFront(sh)
+	return sh, err
+}
+
+// evict writes the buffered lines of the shard, then closes it.
+func (s *Sharder) evict(elem *list.Element) error {
+	sh := s.lru.Remove(elem).(*shard)
+	delete(s.shards, sh.name)
+	if sh.err != nil {
+		return fmt.Errorf("cannot open shard %q: %w", sh.name, sh.err)
+	}
+	err := s.flushShard(sh)
+	if cerr := sh.iowc.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("shard %q: %w", sh.name, cerr)
+	}
+	return err
+}
+
+// flushShard writes the buffered lines of the shard.
+func (s *Sharder) flushShard(sh *shard) error {
+	if len(sh.buf) == 0 {
+		return nil
+	}
+	nw, err := sh.iowc.Write(sh.buf)
+	if err == nil && nw < len(sh.buf) {
+		err = io.ErrShortWrite
+	}
+	sh.buf = sh.buf[:0]
+	if err != nil {
+		return fmt.Errorf("shard %q: %w", sh.name, err)
+	}
+	return nil
+}
+
+// Write writes each line of p to the shard for its key, writing the lines for
+// each shard with a single write. Final bytes of p without a trailing
+// delimiter are written as a line. Because each line is written at most once,
+// Write reports all of p as written even when it returns an error. The
+// returned error joins the errors from every shard that could not be opened or
+// written.
+func (s *Sharder) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+
+	var errs []error
+	_ = EachLine(p, s.options.Delimiter, func(line, raw []byte) error {
+		key := s.options.Key(line)
+		if len(key) == 0 {
+			key = s.defaultKey
+		}
+		sh, err := s.shard(key)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if sh.err == nil {
+			sh.buf = append(sh.buf, raw...)
+		}
+		return nil
+	})
+
+	for elem := s.lru.Front(); elem != nil; {
+		sh := elem.Value.(*shard)
+		next := elem.Next()
+		if sh.err != nil {
+			// Forget the shard, so it is opened again by a later Write.
+			errs = append(errs, fmt.Errorf("cannot open shard %q: %w", sh.name, sh.err))
+			s.lru.Remove(elem)
+			delete(s.shards, sh.name)
+		} else if err := s.flushShard(sh); err != nil {
+			errs = append(errs, err)
+		}
+		elem = next
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// Close closes every open shard, and returns the errors from closing them
+// joined by errors.Join.
+func (s *Sharder) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	s.closed = true
+
+	var errs []error
+	for s.lru.Len() > 0 {
+		if err := s.evict(s.lru.Back()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,184 @@
+package golfw
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// KeyFunc returns the key of a line, or nil when the line has no key. An empty
+// key is treated as no key. The line does not include its delimiter. The returned key may refer to the bytes of
+// line, and is only valid until line is modified.
+type KeyFunc func(line []byte) []byte
+
+// LogfmtKey returns a KeyFunc that returns the value of the specified logfmt
+// key, for instance the value of tenant in `level=info tenant=acme msg="hi"`.
+// When the value is quoted, the key is the bytes between the quotes, without
+// unescaping them.
+func LogfmtKey(name string) KeyFunc {
+	prefix := []byte(name + "=")
+	return func(line []byte) []byte {
+		for i := 0; i < len(line); {
+			// Find the start of the next field.
+			for i < len(line) && line[i] == ' ' {
+				i++
+			}
+			if bytes.HasPrefix(line[i:], prefix) {
+				value, _ := logfmtValue(line[i+len(prefix):])
+				return value
+			}
+			// Skip this field, including a quoted value with spaces.
+			for i < len(line) && line[i] != ' ' {
+				if line[i] == '"' {
+					_, n := logfmtValue(line[i:])
+					i += n
+					continue
+				}
+				i++
+			}
+		}
+		return nil
+	}
+}
+
+// logfmtValue returns the value at the start of buf, and the number of bytes
+// it occupies, including its quotes when it is quoted.
+func logfmtValue(buf []byte) ([]byte, int) {
+	if len(buf) == 0 || buf[0] != '"' {
+		if i := bytes.IndexByte(buf, ' '); i >= 0 {
+			return buf[:i], i
+		}
+		return buf, len(buf)
+	}
+	for i := 1; i < len(buf); i++ {
+		switch buf[i] {
+		case '\\':
+			i++ // skip escaped byte
+		case '"':
+			return buf[1:i], i + 1
+		}
+	}
+	return buf[1:], len(buf) // unterminated quote
+}
+
+// JSONKey returns a KeyFunc that returns the value of the specified field of a
+// line that is a JSON object, for instance the value of tenant in
+// `{"tenant":"acme","msg":"hi"}`. Only fields of the top level object are
+// considered. When the value is a string, the key is the bytes between its
+// quotes, without unescaping them, otherwise it is the literal value.
+func JSONKey(field string) KeyFunc {
+	name := []byte(field)
+	return func(line []byte) []byte {
+		i := skipJSONSpace(line, 0)
+		if i == len(line) || line[i] != '{' {
+			return nil
+		}
+		i++
+		for {
+			i = skipJSONSpace(line, i)
+			if i == len(line) || line[i] != '"' {
+				return nil // end of object, or malformed
+			}
+			end := skipJSONValue(line, i)
+			if end < 0 {
+				return nil
+			}
+			key := line[i+1 : end-1]
+			i = skipJSONSpace(line, end)
+			if i == len(line) || line[i] != ':' {
+				return nil
+			}
+			i = skipJSONSpace(line, i+1)
+			end = skipJSONValue(line, i)
+			if end < 0 {
+				return nil
+			}
+			if bytes.Equal(key, name) {
+				if line[i] == '"' {
+					return line[i+1 : end-1]
+				}
+				return line[i:end]
+			}
+			i = skipJSONSpace(line, end)
+			if i == len(line) || line[i] != ',' {
+				return nil
+			}
+			i++
+		}
+	}
+}
+
+func skipJSONSpace(buf []byte, i int) int {
+	for i < len(buf) && (buf[i] == ' ' || buf[i] == '\t' || buf[i] == '\r' || buf[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// skipJSONValue returns the index of the byte after the JSON value that starts
+// at index i of buf, or -1 when the value is malformed.
+func skipJSONValue(buf []byte, i int) int {
+	if i >= len(buf) {
+		return -1
+	}
+	switch buf[i] {
+	case '"':
+		for i++; i < len(buf); i++ {
+			switch buf[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+		return -1
+	case '{', '[':
+		var depth int
+		for ; i < len(buf); i++ {
+			switch buf[i] {
+			case '"':
+				end := skipJSONValue(buf, i)
+				if end < 0 {
+					return -1
+				}
+				i = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	default:
+		start := i
+		for i < len(buf) && !isJSONValueEnd(buf[i]) {
+			i++
+		}
+		if i == start {
+			return -1
+		}
+		return i
+	}
+}
+
+// isJSONValueEnd returns true when b ends a JSON number or literal.
+func isJSONValueEnd(b byte) bool {
+	switch b {
+	case ',', '}', ']', ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
+
+// RegexpKey returns a KeyFunc that returns the bytes matched by the specified
+// capture group of re, for instance group 1 of `tenant=(\w+)`.
+func RegexpKey(re *regexp.Regexp, group int) KeyFunc {
+	return func(line []byte) []byte {
+		loc := re.FindSubmatchIndex(line)
+		if len(loc) <= 2*group+1 || loc[2*group] < 0 {
+			return nil
+		}
+		return line[loc[2*group]:loc[2*group+1]]
+	}
+}
@@ -0,0 +1,197 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+func TestKeyFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		key  KeyFunc
+		line string
+		want string // "<nil>" when no key
+	}{
+		{"logfmt first", LogfmtKey("tenant"), "tenant=acme level=info", "acme"},
+		{"logfmt last", LogfmtKey("tenant"), "level=info tenant=acme", "acme"},
+		{"logfmt quoted", LogfmtKey("tenant"), `level=info tenant="acme corp" msg=hi`, "acme corp"},
+		{"logfmt after quoted", LogfmtKey("tenant"), `msg="a tenant=evil \"b\"" tenant=acme`, "acme"},
+		{"logfmt suffix of other key", LogfmtKey("tenant"), "subtenant=evil", "<nil>"},
+		{"logfmt empty value", LogfmtKey("tenant"), "tenant= level=info", ""},
+		{"logfmt missing", LogfmtKey("tenant"), "level=info", "<nil>"},
+		{"json string", JSONKey("tenant"), `{"level":"info","tenant":"acme"}`, "acme"},
+		{"json number", JSONKey("tenant"), `{ "tenant" : 42 }`, "42"},
+		{"json after nested", JSONKey("tenant"), `{"ctx":{"tenant":"evil","a":[1,"}"]},"tenant":"acme"}`, "acme"},
+		{"json escaped quote", JSONKey("tenant"), `{"msg":"say \"hi\"","tenant":"acme"}`, "acme"},
+		{"json missing", JSONKey("tenant"), `{"level":"info"}`, "<nil>"},
+		{"json not object", JSONKey("tenant"), `tenant=acme`, "<nil>"},
+		{"json malformed", JSONKey("tenant"), `{"tenant"`, "<nil>"},
+		{"regexp", RegexpKey(regexp.MustCompile(`user=(\w+)`), 1), "level=info user=bob", "bob"},
+		{"regexp no match", RegexpKey(regexp.MustCompile(`user=(\w+)`), 1), "level=info", "<nil>"},
+		{"regexp unmatched group", RegexpKey(regexp.MustCompile(`a|(b)`), 1), "a", "<nil>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := "<nil>"
+			if key := test.key([]byte(test.line)); key != nil {
+				got = string(key)
+			}
+			if got != test.want {
+				t.Errorf("GOT: %q; WANT: %q", got, test.want)
+			}
+		})
+	}
+}
+
+// shardRecorder opens in-memory shards, recording each time a shard is opened
+// and closed.
+type shardRecorder struct {
+	shards map[string]*bytes.Buffer
+	events []string
+}
+
+func newShardRecorder() *shardRecorder {
+	return &shardRecorder{shards: make(map[string]*bytes.Buffer)}
+}
+
+func (sr *shardRecorder) open(name string) (io.WriteCloser, error) {
+	if name == "bad" {
+		return nil, errors.New("test open error")
+	}
+	sr.events = append(sr.events, "open "+name)
+	buf, ok := sr.shards[name]
+	if !ok {
+		buf = new(bytes.Buffer)
+		sr.shards[name] = buf
+	}
+	return &recordedShard{Writer: buf, sr: sr, name: name}, nil
+}
+
+type recordedShard struct {
+	io.Writer
+	sr   *shardRecorder
+	name string
+}
+
+func (rs *recordedShard) Close() error {
+	rs.sr.events = append(rs.sr.events, "close "+rs.name)
+	return nil
+}
+
+func TestSharder(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewSharder(ShardOptions{Open: newShardRecorder().open})
+		ensureError(t, err, "Key is nil")
+		_, err = NewSharder(ShardOptions{Key: LogfmtKey("tenant")})
+		ensureError(t, err, "Open is nil")
+		_, err = NewSharder(ShardOptions{Key: LogfmtKey("tenant"), Open: newShardRecorder().open, Shards: -1})
+		ensureError(t, err, "Shards")
+	})
+
+	t.Run("by key", func(t *testing.T) {
+		sr := newShardRecorder()
+		sharder, err := NewSharder(ShardOptions{Key: LogfmtKey("tenant"), Open: sr.open, DefaultKey: "none"})
+		ensureError(t, err)
+		wc, err := NewWriteCloser(sharder, 64)
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "tenant=a 1\ntenant=b 2\nno tenant\ntenant= empty\ntenant=a 3\ntenant=b part")
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, sr.shards["a"], "tenant=a 1\ntenant=a 3\n")
+		ensureBuffer(t, sr.shards["b"], "tenant=b 2\n")
+		ensureBuffer(t, sr.shards["none"], "no tenant\ntenant= empty\n")
+
+		ensureWrite(t, wc, "ial\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, sr.shards["b"], "tenant=b 2\ntenant=b partial\n")
+	})
+
+	t.Run("hashed", func(t *testing.T) {
+		sr := newShardRecorder()
+		sharder, err := NewSharder(ShardOptions{Key: JSONKey("tenant"), Open: sr.open, Shards: 4})
+		ensureError(t, err)
+
+		for _, tenant := range []string{"a", "b", "c", "d", "e", "f", "a"} {
+			_, err = sharder.Write([]byte(`{"tenant":"` + tenant + `"}` + "\n"))
+			ensureError(t, err)
+		}
+		var names []string
+		var total int
+		for name, buf := range sr.shards {
+			names = append(names, name)
+			total += bytes.Count(buf.Bytes(), []byte("\n"))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if name < "0" || name > "3" || len(name) != 1 {
+				t.Errorf("GOT: %q; WANT: shard between 0 and 3", name)
+			}
+		}
+		if got, want := total, 7; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		a := sr.shards[sharder.names[fnv32a([]byte("a"))%4]].String()
+		if got, want := bytes.Count([]byte(a), []byte(`"a"`)), 2; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("closes least recently used", func(t *testing.T) {
+		sr := newShardRecorder()
+		sharder, err := NewSharder(ShardOptions{Key: LogfmtKey("k"), Open: sr.open, MaxOpen: 2})
+		ensureError(t, err)
+
+		_, err = sharder.Write([]byte("k=a 1\nk=b 1\nk=a 2\nk=c 1\nk=b 2\n"))
+		ensureError(t, err)
+		ensure.Strings(t, sr.events, "open a", "open b", "close b", "open c", "close a", "open b")
+		ensureBuffer(t, sr.shards["a"], "k=a 1\nk=a 2\n")
+		ensureBuffer(t, sr.shards["b"], "k=b 1\nk=b 2\n")
+		ensureBuffer(t, sr.shards["c"], "k=c 1\n")
+
+		ensureError(t, sharder.Close())
+		ensure.Strings(t, sr.events[6:], "close c", "close b")
+		ensureError(t, sharder.Close(), "closed")
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		sr := newShardRecorder()
+		sharder, err := NewSharder(ShardOptions{Key: LogfmtKey("k"), Open: sr.open})
+		ensureError(t, err)
+
+		n, err := sharder.Write([]byte("k=bad 1\nk=a 1\nk=bad 2\n"))
+		ensureError(t, err, `cannot open shard "bad": test open error`)
+		if got, want := n, 22; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureBuffer(t, sr.shards["a"], "k=a 1\n")
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		open := ShardFiles(dir, ".log", 0o600)
+		for _, name := range []string{"", ".", "..", "../evil", "a/b", `a\b`} {
+			_, err := open(name)
+			ensureError(t, err, "invalid shard name")
+		}
+
+		sharder, err := NewSharder(ShardOptions{Key: LogfmtKey("k"), Open: open})
+		ensureError(t, err)
+		_, err = sharder.Write([]byte("k=a 1\nk=b 1\n"))
+		ensureError(t, err)
+		ensureError(t, sharder.Close())
+
+		buf, err := os.ReadFile(filepath.Join(dir, "a.log"))
+		ensureError(t, err)
+		if got, want := string(buf), "k=a 1\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+	})
+}
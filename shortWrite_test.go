@@ -0,0 +1,117 @@
+package golfw
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// partialWriter writes at most max bytes to the underlying io.Writer on each
+// invocation, and returns a nil error even when it writes fewer bytes than
+// requested, as some pipes and sockets do.
+type partialWriter struct {
+	io.Writer
+	max int
+}
+
+func (pw *partialWriter) Write(p []byte) (int, error) {
+	if len(p) > pw.max {
+		p = p[:pw.max]
+	}
+	return pw.Writer.Write(p)
+}
+
+func (pw *partialWriter) Close() error { return nil }
+
+// failAfterWriter writes up to max bytes, then fails every write with err.
+type failAfterWriter struct {
+	io.Writer
+	max int
+	err error
+}
+
+func (fw *failAfterWriter) Write(p []byte) (int, error) {
+	if fw.max == 0 {
+		return 0, fw.err
+	}
+	if len(p) > fw.max {
+		p = p[:fw.max]
+	}
+	n, err := fw.Writer.Write(p)
+	fw.max -= n
+	return n, err
+}
+
+func (fw *failAfterWriter) Close() error { return nil }
+
+func TestCompleteShortWrites(t *testing.T) {
+	t.Run("short write errors", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 8, WithCompleteShortWrites())
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\nline 2\nline 3", wantState{
+			buf:                 "line 3",
+			n:                   20,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "line 1\nline 2\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3")
+	})
+
+	t.Run("short write without error", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(&partialWriter{Writer: output, max: 3}, 8, WithCompleteShortWrites())
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\nline 2\nline 3", wantState{
+			buf:                 "line 3",
+			n:                   20,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "line 1\nline 2\n")
+		if got, want := wc.Stats().Flushes, uint64(5); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("no progress", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(&partialWriter{Writer: output, max: 0}, 8, WithCompleteShortWrites())
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\nline 2\n", wantState{
+			n:                   0,
+			indexOfFinalNewline: -1,
+			isShortWrite:        true,
+		})
+	})
+
+	t.Run("no progress retried", func(t *testing.T) {
+		clock := newFakeClock()
+		output := new(bytes.Buffer)
+		sink := &flakyWriter{Writer: ShortWriter(output, 4), errs: []error{io.ErrShortWrite}}
+		wc, err := NewWriteCloser(sink, 8, WithClock(clock), WithCompleteShortWrites(), WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\nline 2\n")
+		ensureBuffer(t, output, "line 1\nline 2\n")
+		ensureSleeps(t, clock, time.Millisecond)
+	})
+
+	t.Run("real error", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(&failAfterWriter{Writer: output, max: 10, err: errWrite{}}, 8, WithCompleteShortWrites())
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+
+		n, err := wc.Write([]byte("line 2\nline 3"))
+		ensureError(t, err, "test write error")
+		if got, want := n, 3; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureBuffer(t, output, "line 1\nlin")
+	})
+}
@@ -0,0 +1,253 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrSpoolFull is returned when lines cannot be written to the underlying
+// io.WriteCloser, and appending them to the spool would cause it to exceed its
+// maximum size. See WithSpool.
+var ErrSpoolFull = errors.New("spool full")
+
+// spoolSuffix is the extension of each spool segment file. Segment names are
+// zero padded sequence numbers, so they sort lexically in the order they were
+// created.
+const spoolSuffix = ".spool"
+
+type spoolSegment struct {
+	name string
+	size int64
+}
+
+// spool is a directory of segment files holding lines that could not be
+// written to the underlying io.WriteCloser, in the order they were written.
+// Lines are appended to the final segment, and replayed from the first.
+type spool struct {
+	dir         string
+	segmentSize int64
+	maxSize     int64 // zero when size is not limited
+	size        int64 // total bytes in all segments
+	segments    []spoolSegment
+	next        uint64   // sequence number of next segment created
+	fh          *os.File // open final segment, or nil
+}
+
+// openSpool returns a spool for the specified directory, creating the
+// directory when it does not exist. Segments remaining from a previous process
+// are replayed before any newly spooled lines.
+func openSpool(dir string, segmentSize, maxSize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create spool directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read spool directory: %w", err)
+	}
+	s := &spool{dir: dir, segmentSize: segmentSize, maxSize: maxSize}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, spoolSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSuffix), 10, 64)
+		if err != nil {
+			continue // not a segment
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read spool directory: %w", err)
+		}
+		s.segments = append(s.segments, spoolSegment{name: name, size: info.Size()})
+		s.size += info.Size()
+		if seq >= s.next {
+			s.next = seq + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].name < s.segments[j].name })
+	return s, nil
+}
+
+// append appends p to the final segment, first creating a new segment when the
+// final segment would exceed the segment size. A single p larger than the
+// segment size is written to its own segment.
+func (s *spool) append(p []byte) error {
+	if s.maxSize > 0 && s.size+int64(len(p)) > s.maxSize {
+		return ErrSpoolFull
+	}
+	if n := len(s.segments); n == 0 || (s.segments[n-1].size > 0 && s.segments[n-1].size+int64(len(p)) > s.segmentSize) {
+		if err := s.closeSegment(); err != nil {
+			return err
+		}
+		s.segments = append(s.segments, spoolSegment{name: fmt.Sprintf("%020d%s", s.next, spoolSuffix)})
+		s.next++
+	}
+	return s.appendFinal(p)
+}
+
+// appendFinal appends p to the final segment, opening it when it is not open.
+func (s *spool) appendFinal(p []byte) error {
+	if s.fh == nil {
+		fh, err := os.OpenFile(s.path(len(s.segments)-1), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("cannot open spool segment: %w", err)
+		}
+		s.fh = fh
+	}
+	nw, err := s.fh.Write(p)
+	s.segments[len(s.segments)-1].size += int64(nw)
+	s.size += int64(nw)
+	if err != nil {
+		return fmt.Errorf("cannot write spool segment: %w", err)
+	}
+	return nil
+}
+
+// replay writes each segment, oldest first, and removes it once it has been
+// completely written. When a write fails, the bytes it wrote are removed from
+// the segment, so they are not written again, and the error is returned.
+func (s *spool) replay(write func([]byte) (int, error)) error {
+	for len(s.segments) > 0 {
+		if len(s.segments) == 1 {
+			if err := s.closeSegment(); err != nil {
+				return err
+			}
+		}
+		path := s.path(0)
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read spool segment: %w", err)
+		}
+		if len(buf) > 0 {
+			nw, err := write(buf)
+			if err == nil && nw < len(buf) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				if nw > 0 {
+					if rerr := s.rewrite(path, buf[nw:]); rerr != nil {
+						return rerr
+					}
+					s.segments[0].size -= int64(nw)
+					s.size -= int64(nw)
+				}
+				return err
+			}
+		}
+		if err = os.Remove(path); err != nil {
+			return fmt.Errorf("cannot remove spool segment: %w", err)
+		}
+		s.size -= s.segments[0].size
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// terminate appends delimiter to the final segment when the spool does not end
+// with one, so the final partial line in the spool is not joined with the first
+// line written by another process that replays the spool. It returns the
+// number of bytes appended.
+func (s *spool) terminate(delimiter []byte) (int, error) {
+	if len(s.segments) == 0 || s.segments[len(s.segments)-1].size == 0 {
+		return 0, nil
+	}
+	final := s.segments[len(s.segments)-1]
+	fh, err := os.Open(s.path(len(s.segments) - 1))
+	if err != nil {
+		return 0, fmt.Errorf("cannot read spool segment: %w", err)
+	}
+	tail := make([]byte, len(delimiter))
+	if final.size < int64(len(tail)) {
+		tail = tail[:final.size]
+	}
+	_, err = fh.ReadAt(tail, final.size-int64(len(tail)))
+	_ = fh.Close()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read spool segment: %w", err)
+	}
+	if bytes.Equal(tail, delimiter) {
+		return 0, nil
+	}
+	// Ignore the maximum size, which can at most be exceeded by one
+	// delimiter, rather than leave a partial line in the spool.
+	if err = s.appendFinal(delimiter); err != nil {
+		return 0, err
+	}
+	return len(delimiter), nil
+}
+
+// rewrite replaces the contents of the segment at path with p.
+func (s *spool) rewrite(path string, p []byte) error {
+	tmp := path + ".tmp"
+	fh, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("cannot rewrite spool segment: %w", err)
+	}
+	_, err = fh.Write(p)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("cannot rewrite spool segment: %w", err)
+	}
+	return nil
+}
+
+// closeSegment flushes the final segment to stable storage and closes it when
+// it is open.
+func (s *spool) closeSegment() error {
+	if s.fh == nil {
+		return nil
+	}
+	err := s.fh.Sync()
+	if cerr := s.fh.Close(); err == nil {
+		err = cerr
+	}
+	s.fh = nil
+	if err != nil {
+		return fmt.Errorf("cannot close spool segment: %w", err)
+	}
+	return nil
+}
+
+func (s *spool) path(i int) string { return filepath.Join(s.dir, s.segments[i].name) }
+
+// writeSpooled writes p to the underlying io.WriteCloser, after first
+// replaying any spooled lines, so lines are written in order. When either
+// write fails, the unwritten bytes of p are appended to the spool, to be
+// replayed by a later flush, and p is reported as written. Without a spool, it
+// simply writes p to the underlying io.WriteCloser.
+func (lbf *WriteCloser) writeSpooled(p []byte) (int, error) {
+	if lbf.spool == nil {
+		return lbf.writeSink(p)
+	}
+	var nw int
+	err := lbf.spool.replay(lbf.writeSink)
+	if err == nil {
+		if nw, err = lbf.writeSink(p); err == nil {
+			return nw, nil
+		}
+	}
+	if len(p) == nw {
+		return nw, nil
+	}
+	if serr := lbf.spool.append(p[nw:]); serr != nil {
+		return nw, fmt.Errorf("cannot spool after %s: %w", err, serr)
+	}
+	lbf.stats.Spooled += uint64(len(p) - nw)
+	return len(p), nil
+}
@@ -0,0 +1,176 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ensureSegments ensures dir holds spool segments with the specified contents,
+// oldest first.
+func ensureSegments(tb testing.TB, dir string, want ...string) {
+	tb.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+	ensureError(tb, err)
+	var got []string
+	for _, path := range paths {
+		buf, err := os.ReadFile(path)
+		ensureError(tb, err)
+		got = append(got, string(buf))
+	}
+	if len(got) != len(want) {
+		tb.Fatalf("GOT: %q; WANT: %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			tb.Errorf("GOT: %q; WANT: %q", got, want)
+			break
+		}
+	}
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := NewWriteCloser(NopCloseWriter(new(bytes.Buffer)), 8, WithSpool(dir, 0, 0))
+		ensureError(t, err, "segment size")
+		_, err = NewWriteCloser(NopCloseWriter(new(bytes.Buffer)), 8, WithSpool(dir, 64, -1))
+		ensureError(t, err, "maximum size")
+	})
+
+	t.Run("replays in order after recovery", func(t *testing.T) {
+		dir := t.TempDir()
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 8, WithSpool(dir, 1024, 0))
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\nline 2\nline", wantState{
+			buf:                 "line",
+			n:                   18,
+			indexOfFinalNewline: -1,
+		})
+		ensureBuffer(t, output, "")
+		ensureSegments(t, dir, "line 1\nline 2\n")
+		if got, want := wc.Stats().SpoolBytes, int64(14); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		fw.max = 1024
+		ensureWrite(t, wc, " 3\nline 4\n")
+		ensureBuffer(t, output, "line 1\nline 2\nline 3\nline 4\n")
+		ensureSegments(t, dir)
+
+		stats := wc.Stats()
+		if got, want := stats.Spooled, uint64(14); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if got, want := stats.SpoolBytes, int64(0); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureError(t, wc.Close())
+	})
+
+	t.Run("spools while replay fails", func(t *testing.T) {
+		dir := t.TempDir()
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 1, WithSpool(dir, 14, 0))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		ensureWrite(t, wc, "line 2\n")
+		ensureWrite(t, wc, "line 3\n")
+		ensureBuffer(t, output, "")
+		ensureSegments(t, dir, "line 1\nline 2\n", "line 3\n")
+
+		// Sink accepts only part of first segment before failing again.
+		fw.max = 3
+		ensureWrite(t, wc, "line 4\n")
+		ensureBuffer(t, output, "lin")
+		ensureSegments(t, dir, "e 1\nline 2\n", "line 3\nline 4\n")
+
+		fw.max = 1024
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3\nline 4\n")
+		ensureSegments(t, dir)
+		ensureError(t, wc.Close())
+	})
+
+	t.Run("survives restart", func(t *testing.T) {
+		dir := t.TempDir()
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 8, WithSpool(dir, 8, 0))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\nline 2\nline 3")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "")
+		ensureSegments(t, dir, "line 1\nline 2\n", "line 3\n")
+
+		fw.max = 1024
+		wc, err = NewWriteCloser(fw, 8, WithSpool(dir, 8, 0))
+		ensureError(t, err)
+		ensureError(t, wc.Flush())
+		ensureBuffer(t, output, "line 1\nline 2\nline 3\n")
+		ensureSegments(t, dir)
+
+		ensureWrite(t, wc, "line 4\n")
+		ensureSegments(t, dir)
+		ensureError(t, wc.Close())
+	})
+
+	t.Run("partial line at close not joined after restart", func(t *testing.T) {
+		dir := t.TempDir()
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 64, WithSpool(dir, 1024, 0))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\npartial")
+		ensureError(t, wc.Close())
+		if got, want := wc.Stats().Spooled, uint64(15); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+
+		fw.max = 1024
+		wc, err = NewWriteCloser(fw, 1, WithSpool(dir, 1024, 0))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 2\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\npartial\nline 2\n")
+		ensureSegments(t, dir)
+	})
+
+	t.Run("partial line left by crash not joined after restart", func(t *testing.T) {
+		dir := t.TempDir()
+		ensureError(t, os.WriteFile(filepath.Join(dir, "00000000000000000000"+spoolSuffix), []byte("line 1\r\npartial\r"), 0o600))
+
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 1, WithDelimiter([]byte("\r\n")), WithSpool(dir, 1024, 0))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 2\r\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, output, "line 1\r\npartial\r\r\nline 2\r\n")
+	})
+
+	t.Run("full", func(t *testing.T) {
+		dir := t.TempDir()
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		wc, err := NewWriteCloser(fw, 1, WithSpool(dir, 1024, 10))
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\n")
+		n, err := wc.Write([]byte("line 2\n"))
+		if got, want := n, 0; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		if !errors.Is(err, ErrSpoolFull) {
+			t.Errorf("GOT: %v; WANT: %v", err, ErrSpoolFull)
+		}
+		ensureSegments(t, dir, "line 1\n")
+	})
+}
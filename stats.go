@@ -0,0 +1,71 @@
+package golfw
+
+// Stats is a snapshot of the counters of a WriteCloser, returned by its Stats
+// method.
+type Stats struct {
+	// LinesWritten is the number of delimiters written to the underlying
+	// io.WriteCloser. For a WriteCloser configured by WithAsync, it counts the
+	// delimiters handed to the background goroutine, less those it discarded
+	// because the queue was full, the drain timeout elapsed, or its write
+	// failed.
+	LinesWritten uint64
+
+	// BytesIn is the number of bytes accepted by Write.
+	BytesIn uint64
+
+	// BytesFlushed is the number of bytes written to the underlying
+	// io.WriteCloser. Like LinesWritten, for a WriteCloser configured by
+	// WithAsync, it excludes bytes the background goroutine discarded.
+	BytesFlushed uint64
+
+	// Flushes is the number of times bytes were written to the underlying
+	// io.WriteCloser.
+	Flushes uint64
+
+	// SinkErrors is the number of errors returned by the underlying
+	// io.WriteCloser.
+	SinkErrors uint64
+
+	// Buffered is the number of bytes currently in the buffer.
+	Buffered int
+
+	// PeakBuffered is the largest number of bytes that have been in the
+	// buffer.
+	PeakBuffered int
+
+	// PartialLinesAtClose is the number of final lines without a trailing
+	// delimiter written by Close.
+	PartialLinesAtClose uint64
+
+	// Dropped is the number of chunks of lines discarded because the queue of
+	// a WriteCloser configured by WithAsync was full.
+	Dropped uint64
+
+	// Spooled is the number of bytes appended to the spool of a WriteCloser
+	// configured by WithSpool.
+	Spooled uint64
+
+	// SpoolBytes is the number of bytes currently in the spool of a
+	// WriteCloser configured by WithSpool.
+	SpoolBytes int64
+}
+
+// Stats returns a snapshot of the counters of the WriteCloser.
+func (lbf *WriteCloser) Stats() Stats {
+	lbf.lock.Lock()
+	stats := lbf.stats
+	stats.Buffered = len(lbf.buf)
+	if lbf.spool != nil {
+		stats.SpoolBytes = lbf.spool.size
+	}
+	lbf.lock.Unlock()
+
+	if lbf.async != nil {
+		lbf.async.lock.Lock()
+		stats.Dropped = uint64(lbf.async.dropped)
+		stats.BytesFlushed -= uint64(lbf.async.discardedBytes)
+		stats.LinesWritten -= uint64(lbf.async.discardedLines)
+		lbf.async.lock.Unlock()
+	}
+	return stats
+}
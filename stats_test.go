@@ -0,0 +1,124 @@
+package golfw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func ensureStats(tb testing.TB, wc *WriteCloser, want Stats) {
+	tb.Helper()
+	if got := wc.Stats(); got != want {
+		tb.Errorf("GOT: %+v; WANT: %+v", got, want)
+	}
+}
+
+func TestStats(t *testing.T) {
+	t.Run("counts", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(output), 8)
+		ensureError(t, err)
+		ensureStats(t, wc, Stats{})
+
+		ensureWrite(t, wc, "line 1")
+		ensureStats(t, wc, Stats{BytesIn: 6, Buffered: 6, PeakBuffered: 6})
+
+		ensureWrite(t, wc, "\nline 2\nline 3")
+		ensureStats(t, wc, Stats{
+			LinesWritten: 2,
+			BytesIn:      20,
+			BytesFlushed: 14,
+			Flushes:      1,
+			Buffered:     6,
+			PeakBuffered: 20,
+		})
+
+		ensureError(t, wc.Close())
+		ensureStats(t, wc, Stats{
+			LinesWritten:        2,
+			BytesIn:             20,
+			BytesFlushed:        20,
+			Flushes:             2,
+			PeakBuffered:        20,
+			PartialLinesAtClose: 1,
+		})
+		ensureBuffer(t, output, "line 1\nline 2\nline 3")
+	})
+
+	t.Run("close without partial line", func(t *testing.T) {
+		wc, err := NewWriteCloser(NopCloseWriter(new(bytes.Buffer)), 64)
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\n")
+		ensureError(t, wc.Close())
+		ensureStats(t, wc, Stats{
+			LinesWritten: 1,
+			BytesIn:      7,
+			BytesFlushed: 7,
+			Flushes:      1,
+			PeakBuffered: 7,
+		})
+	})
+
+	t.Run("sink errors", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		wc, err := NewWriteCloser(NopCloseWriter(ShortWriter(output, 4)), 4)
+		ensureError(t, err)
+
+		ensureWriteResponse(t, wc, "line 1\n", wantState{
+			n:                   4,
+			indexOfFinalNewline: -1,
+			isShortWrite:        true,
+		})
+		ensureStats(t, wc, Stats{
+			BytesIn:      4,
+			BytesFlushed: 4,
+			Flushes:      1,
+			SinkErrors:   1,
+			PeakBuffered: 7,
+		})
+	})
+
+	t.Run("close error", func(t *testing.T) {
+		wc, err := NewWriteCloser(&errOnClose{}, 64, WithDelimiter([]byte("\r\n")))
+		ensureError(t, err)
+		ensureWrite(t, wc, "line 1\r\nline 2")
+		ensureError(t, wc.Close(), "test close error")
+		ensureStats(t, wc, Stats{
+			LinesWritten:        1,
+			BytesIn:             14,
+			BytesFlushed:        14,
+			Flushes:             1,
+			SinkErrors:          1,
+			PeakBuffered:        14,
+			PartialLinesAtClose: 1,
+		})
+	})
+
+	t.Run("async dropped", func(t *testing.T) {
+		wc, output := func() (*WriteCloser, *gatedWriter) {
+			output := newGatedWriter()
+			wc, err := NewWriteCloser(output, 1, WithAsync(1, DropNewest))
+			ensureError(t, err)
+			ensureWrite(t, wc, "line 1\n")
+			<-output.started
+			ensureWrite(t, wc, "line 2\n")
+			ensureWrite(t, wc, "line 3\n")
+			return wc, output
+		}()
+		if got, want := wc.Stats().Dropped, uint64(1); got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		go output.release(2)
+		ensureError(t, wc.Close())
+		if got, want := output.String(), "line 1\nline 2\n"; got != want {
+			t.Errorf("GOT: %q; WANT: %q", got, want)
+		}
+		ensureStats(t, wc, Stats{
+			LinesWritten: 2,
+			BytesIn:      21,
+			BytesFlushed: 14,
+			Flushes:      3,
+			PeakBuffered: 7,
+			Dropped:      1,
+		})
+	})
+}
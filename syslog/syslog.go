@@ -0,0 +1,353 @@
+// Package syslog provides a writer that sends each line written to it as a
+// syslog message with an RFC 5424 header, over a unix datagram socket, UDP, or
+// TCP. Messages sent over a stream transport are framed by octet counting as
+// described by RFC 6587. It is designed to be the underlying io.WriteCloser of
+// a golfw.WriteCloser, which only hands it complete lines, so each message is
+// a complete line.
+//
+//     func Example() error {
+//         sw, err := syslog.New("udp", "localhost:514", syslog.Local0, syslog.Informational, &syslog.Options{
+//             ParseSeverity: syslog.PrefixSeverity,
+//         })
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(sw, 16384)
+//         if err != nil {
+//             _ = sw.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes sw.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karrick/golfw"
+)
+
+// Facility is the facility of a syslog message, as defined by RFC 5424.
+type Facility int
+
+// Facilities defined by RFC 5424.
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	Lpr
+	News
+	Uucp
+	Cron
+	Authpriv
+	Ftp
+	Ntp
+	LogAudit
+	LogAlert
+	Clock
+	Local0
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+// Severity is the severity of a syslog message, as defined by RFC 5424.
+type Severity int
+
+// Severities defined by RFC 5424.
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Informational
+	Debug
+)
+
+// timestampFormat is the RFC 5424 TIMESTAMP with microsecond precision.
+const timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Maximum lengths of header fields, as defined by RFC 5424.
+const (
+	maxHostname = 255
+	maxAppName  = 48
+	maxProcID   = 128
+	maxMsgID    = 32
+)
+
+// Options configures a Writer.
+type Options struct {
+	// Hostname is the HOSTNAME of each message. When empty, the name
+	// returned by os.Hostname is used.
+	Hostname string
+
+	// AppName is the APP-NAME of each message. When empty, the base name of
+	// the program is used.
+	AppName string
+
+	// ProcID is the PROCID of each message. When empty, the process ID is
+	// used.
+	ProcID string
+
+	// MsgID is the MSGID of each message. When empty, the MSGID is nil.
+	MsgID string
+
+	// ParseSeverity, when not nil, is invoked with each line to determine
+	// its severity. When it returns false, the severity of the Writer is
+	// used. The returned message is sent in place of the line, allowing the
+	// function to strip a prefix from the line. See PrefixSeverity.
+	ParseSeverity func(line []byte) (Severity, []byte, bool)
+
+	// DialTimeout is the maximum duration to wait for a connection to be
+	// established. When zero, there is no timeout beyond that of the
+	// operating system.
+	DialTimeout time.Duration
+
+	// Delimiter is the record delimiter of the chunks written to the Writer.
+	// When empty, LF is used.
+	Delimiter []byte
+}
+
+// PrefixSeverity parses the severity from a `<N>` prefix of line, where N is a
+// digit from 0 to 7, as written by programs that log to stderr under systemd,
+// and returns the line without the prefix.
+func PrefixSeverity(line []byte) (Severity, []byte, bool) {
+	if len(line) < 3 || line[0] != '<' || line[1] < '0' || line[1] > '7' || line[2] != '>' {
+		return 0, line, false
+	}
+	return Severity(line[1] - '0'), line[3:], true
+}
+
+// Writer is an io.WriteCloser that sends each line written to it as a syslog
+// message. When a write fails, the connection is closed, and a new connection
+// is established by the next write. Its methods are safe to invoke from
+// multiple goroutines.
+type Writer struct {
+	lock     sync.Mutex
+	network  string
+	address  string
+	facility Facility
+	severity Severity
+	options  Options
+	header   []byte // " HOSTNAME APP-NAME PROCID MSGID - " following TIMESTAMP
+	stream   bool   // true when messages are framed by octet counting
+	conn     net.Conn
+	buf      []byte // reused for formatting messages
+	ends     []int  // reused for offsets into p of the end of each message
+	closed   bool
+	now      func() time.Time
+}
+
+// New returns a Writer that sends messages with the specified facility and
+// severity to the syslog daemon at address. The network is "unixgram",
+// "unix", "udp", "udp4", "udp6", "tcp", "tcp4", or "tcp6". Messages sent over
+// "unix" and "tcp" networks are framed by octet counting. When options is nil,
+// the defaults described by Options are used.
+func New(network, address string, facility Facility, severity Severity, options *Options) (*Writer, error) {
+	if facility < Kern || facility > Local7 {
+		return nil, fmt.Errorf("cannot create Writer with invalid facility: %d", facility)
+	}
+	if severity < Emergency || severity > Debug {
+		return nil, fmt.Errorf("cannot create Writer with invalid severity: %d", severity)
+	}
+	w := &Writer{
+		network:  network,
+		address:  address,
+		facility: facility,
+		severity: severity,
+		now:      time.Now,
+	}
+	switch network {
+	case "unixgram", "udp", "udp4", "udp6":
+	case "unix", "tcp", "tcp4", "tcp6":
+		w.stream = true
+	default:
+		return nil, fmt.Errorf("cannot create Writer with unsupported network: %q", network)
+	}
+	if options != nil {
+		w.options = *options
+	}
+	if w.options.Hostname == "" {
+		w.options.Hostname, _ = os.Hostname()
+	}
+	if w.options.AppName == "" {
+		w.options.AppName = filepath.Base(os.Args[0])
+	}
+	if w.options.ProcID == "" {
+		w.options.ProcID = strconv.Itoa(os.Getpid())
+	}
+	if len(w.options.Delimiter) == 0 {
+		w.options.Delimiter = []byte{'\n'}
+	}
+	w.header = append(w.header, ' ')
+	w.header = appendField(w.header, w.options.Hostname, maxHostname)
+	w.header = append(w.header, ' ')
+	w.header = appendField(w.header, w.options.AppName, maxAppName)
+	w.header = append(w.header, ' ')
+	w.header = appendField(w.header, w.options.ProcID, maxProcID)
+	w.header = append(w.header, ' ')
+	w.header = appendField(w.header, w.options.MsgID, maxMsgID)
+	w.header = append(w.header, " - "...) // no STRUCTURED-DATA
+
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// appendField appends a header field, which RFC 5424 limits to printable
+// US-ASCII, to buf. Other bytes are replaced with an underscore. When the field
+// is empty, the NILVALUE is appended.
+func appendField(buf []byte, field string, max int) []byte {
+	if field == "" {
+		return append(buf, '-')
+	}
+	if len(field) > max {
+		field = field[:max]
+	}
+	for i := 0; i < len(field); i++ {
+		if b := field[i]; b >= 33 && b <= 126 {
+			buf = append(buf, b)
+		} else {
+			buf = append(buf, '_')
+		}
+	}
+	return buf
+}
+
+func (w *Writer) dial() error {
+	conn, err := net.DialTimeout(w.network, w.address, w.options.DialTimeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// appendMessage appends the message for line to w.buf, framed by octet
+// counting when the transport is a stream.
+func (w *Writer) appendMessage(line []byte, now time.Time) {
+	severity := w.severity
+	if w.options.ParseSeverity != nil {
+		if s, msg, ok := w.options.ParseSeverity(line); ok && s >= Emergency && s <= Debug {
+			severity, line = s, msg
+		}
+	}
+	start := len(w.buf)
+	w.buf = append(w.buf, '<')
+	w.buf = strconv.AppendInt(w.buf, int64(w.facility)*8+int64(severity), 10)
+	w.buf = append(w.buf, ">1 "...)
+	w.buf = now.AppendFormat(w.buf, timestampFormat)
+	w.buf = append(w.buf, w.header...)
+	w.buf = append(w.buf, line...)
+	if w.stream {
+		// Prepend the length of the message and a space.
+		var prefix [20]byte
+		length := strconv.AppendInt(prefix[:0], int64(len(w.buf)-start), 10)
+		length = append(length, ' ')
+		w.buf = append(w.buf, length...)
+		copy(w.buf[start+len(length):], w.buf[start:len(w.buf)-len(length)])
+		copy(w.buf[start:], length)
+	}
+}
+
+// Write sends each line of p as a syslog message. Final bytes of p without a
+// trailing delimiter are sent as a message. Messages sent over a datagram
+// transport are sent one per datagram, while messages sent over a stream
+// transport are sent with a single write. When a write fails, the returned
+// count includes only the bytes of the lines whose messages were completely
+// sent, so writing the remaining bytes again sends each remaining message
+// once, and the connection is closed, so it does not resume with a partial
+// message.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.conn == nil {
+		if err := w.dial(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := w.now()
+	w.buf = w.buf[:0]
+	w.ends = w.ends[:0]
+	var sent int     // bytes of p whose messages were sent
+	var consumed int // bytes of p whose messages were formatted
+	err := golfw.EachLine(p, w.options.Delimiter, func(line, raw []byte) error {
+		w.appendMessage(line, now)
+		consumed += len(raw)
+
+		if !w.stream {
+			if _, err := w.conn.Write(w.buf); err != nil {
+				return err
+			}
+			sent = consumed
+			w.buf = w.buf[:0]
+		} else {
+			w.ends = append(w.ends, len(w.buf), consumed)
+		}
+		return nil
+	})
+	if err != nil {
+		return sent, w.fail(err)
+	}
+	if w.stream && len(w.buf) > 0 {
+		nw, err := w.conn.Write(w.buf)
+		if err != nil {
+			// Count the lines of the messages that were completely written.
+			for i := 0; i < len(w.ends) && w.ends[i] <= nw; i += 2 {
+				sent = w.ends[i+1]
+			}
+			return sent, w.fail(err)
+		}
+	}
+	return len(p), nil
+}
+
+// fail closes the connection after a failed write, and returns err.
+func (w *Writer) fail(err error) error {
+	_ = w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// Close closes the connection to the syslog daemon.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,138 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw"
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+var testTime = time.Date(2022, 3, 5, 12, 30, 15, 123456789, time.UTC)
+
+var testOptions = Options{
+	Hostname: "host",
+	AppName:  "app",
+	ProcID:   "42",
+}
+
+// readFrames returns the next count messages framed by octet counting read
+// from br.
+func readFrames(tb testing.TB, br *bufio.Reader, count int) []string {
+	tb.Helper()
+	var messages []string
+	for len(messages) < count {
+		length, err := br.ReadString(' ')
+		ensure.Error(tb, err)
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		ensure.Error(tb, err)
+		buf := make([]byte, n)
+		_, err = io.ReadFull(br, buf)
+		ensure.Error(tb, err)
+		messages = append(messages, string(buf))
+	}
+	return messages
+}
+
+func TestPrefixSeverity(t *testing.T) {
+	tests := []struct {
+		line     string
+		severity Severity
+		msg      string
+		ok       bool
+	}{
+		{"<3>failed", Error, "failed", true},
+		{"<7>", Debug, "", true},
+		{"<8>bad", 0, "<8>bad", false},
+		{"<3bad", 0, "<3bad", false},
+		{"plain", 0, "plain", false},
+	}
+	for _, test := range tests {
+		severity, msg, ok := PrefixSeverity([]byte(test.line))
+		if severity != test.severity || string(msg) != test.msg || ok != test.ok {
+			t.Errorf("%q: GOT: %v %q %v; WANT: %v %q %v", test.line, severity, msg, ok, test.severity, test.msg, test.ok)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("udp", "127.0.0.1:514", Facility(24), Informational, nil)
+	ensure.Error(t, err, "invalid facility")
+	_, err = New("udp", "127.0.0.1:514", User, Severity(8), nil)
+	ensure.Error(t, err, "invalid severity")
+	_, err = New("ip", "127.0.0.1", User, Informational, nil)
+	ensure.Error(t, err, "unsupported network")
+}
+
+func TestUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	ensure.Error(t, err)
+	defer pc.Close()
+
+	options := testOptions
+	options.ParseSeverity = PrefixSeverity
+	options.MsgID = "has space"
+	sw, err := New("udp", pc.LocalAddr().String(), Local0, Informational, &options)
+	ensure.Error(t, err)
+	sw.now = func() time.Time { return testTime }
+
+	lf, err := golfw.NewWriteCloser(sw, 1024)
+	ensure.Error(t, err)
+	_, err = lf.Write([]byte("started\n<3>failed\npartial"))
+	ensure.Error(t, err)
+	ensure.Error(t, lf.Close())
+
+	ensure.Datagrams(t, pc,
+		"<134>1 2022-03-05T12:30:15.123456Z host app 42 has_space - started",
+		"<131>1 2022-03-05T12:30:15.123456Z host app 42 has_space - failed",
+		"<134>1 2022-03-05T12:30:15.123456Z host app 42 has_space - partial",
+	)
+	ensure.Error(t, sw.Close(), "closed")
+}
+
+func TestTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ensure.Error(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	sw, err := New("tcp", ln.Addr().String(), User, Notice, &testOptions)
+	ensure.Error(t, err)
+	sw.now = func() time.Time { return testTime }
+
+	conn := <-accepted
+	_, err = sw.Write([]byte("line 1\nline 2\n"))
+	ensure.Error(t, err)
+	ensure.Strings(t, readFrames(t, bufio.NewReader(conn), 2),
+		"<13>1 2022-03-05T12:30:15.123456Z host app 42 - - line 1",
+		"<13>1 2022-03-05T12:30:15.123456Z host app 42 - - line 2",
+	)
+
+	// After a failed write, next write dials a new connection.
+	_ = sw.fail(io.ErrClosedPipe)
+	_, err = sw.Write([]byte("line 3\n"))
+	ensure.Error(t, err)
+	conn2 := <-accepted
+	ensure.Strings(t, readFrames(t, bufio.NewReader(conn2), 1),
+		"<13>1 2022-03-05T12:30:15.123456Z host app 42 - - line 3",
+	)
+
+	ensure.Error(t, sw.Close())
+	_ = conn.Close()
+	_ = conn2.Close()
+}
@@ -0,0 +1,40 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package syslog
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karrick/golfw/internal/ensure"
+)
+
+func TestUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	pc, err := net.ListenPacket("unixgram", path)
+	ensure.Error(t, err)
+	defer pc.Close()
+
+	sw, err := New("unixgram", path, Daemon, Warning, &testOptions)
+	ensure.Error(t, err)
+	sw.now = func() time.Time { return testTime }
+
+	n, err := sw.Write([]byte("line 1\nline 2\n"))
+	ensure.Error(t, err)
+	if got, want := n, 14; got != want {
+		t.Errorf("GOT: %v; WANT: %v", got, want)
+	}
+	ensure.Datagrams(t, pc,
+		"<28>1 2022-03-05T12:30:15.123456Z host app 42 - - line 1",
+		"<28>1 2022-03-05T12:30:15.123456Z host app 42 - - line 2",
+	)
+	ensure.Error(t, sw.Close())
+
+	// Datagrams sent to a socket without a listener fail.
+	_ = pc.Close()
+	sw, err = New("unixgram", path, Daemon, Warning, &testOptions)
+	ensure.Error(t, err, "connect")
+}
@@ -0,0 +1,176 @@
+package golfw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// SinkPolicy determines how a Tee handles errors from one of its sinks.
+type SinkPolicy int
+
+const (
+	// SinkRequired causes errors from the sink to be returned by Write.
+	SinkRequired SinkPolicy = iota
+
+	// SinkBestEffort causes errors from the sink to be ignored.
+	SinkBestEffort
+
+	// SinkDisableAfterFailures causes errors from the sink to be ignored
+	// until it fails MaxFailures consecutive times, after which it is no
+	// longer written to. The error that disables the sink is returned by
+	// Write.
+	SinkDisableAfterFailures
+)
+
+// TeeSink is one of the sinks of a Tee.
+type TeeSink struct {
+	// Writer is the sink.
+	Writer io.WriteCloser
+
+	// Policy determines how errors from Writer are handled.
+	Policy SinkPolicy
+
+	// MaxFailures is the number of consecutive failures after which a sink
+	// with the SinkDisableAfterFailures policy is disabled.
+	MaxFailures int
+
+	// OnError, when not nil, is invoked with each error returned by Writer,
+	// regardless of Policy.
+	OnError func(error)
+}
+
+// teeSink is a TeeSink along with its state.
+type teeSink struct {
+	TeeSink
+	failures int // consecutive failures
+	disabled bool
+}
+
+// Tee is an io.WriteCloser that writes each chunk written to it to every one of
+// its sinks. Unlike io.MultiWriter, a failing sink does not prevent the chunk
+// from being written to the remaining sinks, and each sink has its own error
+// policy. Its methods are safe to invoke from multiple goroutines.
+//
+// It is designed to be the underlying io.WriteCloser of a WriteCloser, which
+// only hands it chunks of complete lines, so each sink receives whole lines.
+//
+//     func Example(conn net.Conn, fh *os.File) error {
+//         tee, err := golfw.NewTee(
+//             golfw.TeeSink{Writer: fh, Policy: golfw.SinkRequired},
+//             golfw.TeeSink{Writer: conn, Policy: golfw.SinkDisableAfterFailures, MaxFailures: 10},
+//         )
+//         if err != nil {
+//             return err
+//         }
+//         lf, err := golfw.NewWriteCloser(tee, 16384)
+//         if err != nil {
+//             _ = tee.Close()
+//             return err
+//         }
+//         _, rerr := io.Copy(lf, os.Stdin)
+//         cerr := lf.Close() // NOTE: Also closes conn and fh.
+//         if rerr == nil {
+//             return cerr
+//         }
+//         return rerr
+//     }
+type Tee struct {
+	lock   sync.Mutex
+	sinks  []teeSink
+	closed bool
+}
+
+// NewTee returns a Tee that writes to the specified sinks.
+func NewTee(sinks ...TeeSink) (*Tee, error) {
+	t := &Tee{sinks: make([]teeSink, len(sinks))}
+	for i, sink := range sinks {
+		if sink.Writer == nil {
+			return nil, fmt.Errorf("cannot create Tee when sink %d has nil Writer", i)
+		}
+		switch sink.Policy {
+		case SinkRequired, SinkBestEffort:
+		case SinkDisableAfterFailures:
+			if sink.MaxFailures <= 0 {
+				return nil, fmt.Errorf("cannot create Tee when sink %d has MaxFailures less than or equal to 0: %d", i, sink.MaxFailures)
+			}
+		default:
+			return nil, fmt.Errorf("cannot create Tee when sink %d has unknown policy: %d", i, sink.Policy)
+		}
+		t.sinks[i].TeeSink = sink
+	}
+	return t, nil
+}
+
+// Disabled returns true when the sink at the specified index has been disabled
+// by the SinkDisableAfterFailures policy.
+func (t *Tee) Disabled(i int) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.sinks[i].disabled
+}
+
+// Write writes p to every sink that has not been disabled. Because each chunk
+// is written to each sink at most once, Write reports all of p as written even
+// when it returns an error, so a WriteCloser does not write the chunk again to
+// the sinks that succeeded. The returned error joins the errors from sinks with
+// the SinkRequired policy and the error that disabled a sink, if any.
+func (t *Tee) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return 0, os.ErrClosed
+	}
+
+	var errs []error
+	for i := range t.sinks {
+		sink := &t.sinks[i]
+		if sink.disabled {
+			continue
+		}
+		nw, err := sink.Writer.Write(p)
+		if err == nil && nw < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			sink.failures = 0
+			continue
+		}
+		if sink.OnError != nil {
+			sink.OnError(err)
+		}
+		switch sink.Policy {
+		case SinkRequired:
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		case SinkDisableAfterFailures:
+			if sink.failures++; sink.failures >= sink.MaxFailures {
+				sink.disabled = true
+				errs = append(errs, fmt.Errorf("sink %d disabled after %d consecutive failures: %w", i, sink.failures, err))
+			}
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// Close closes every sink, including disabled sinks, and returns the errors
+// from closing them joined by errors.Join.
+func (t *Tee) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return os.ErrClosed
+	}
+	t.closed = true
+
+	var errs []error
+	for i := range t.sinks {
+		if err := t.sinks[i].Writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
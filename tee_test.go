@@ -0,0 +1,106 @@
+package golfw
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTee(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewTee(TeeSink{})
+		ensureError(t, err, "nil Writer")
+		_, err = NewTee(TeeSink{Writer: NopCloseWriter(new(bytes.Buffer)), Policy: SinkDisableAfterFailures})
+		ensureError(t, err, "MaxFailures")
+		_, err = NewTee(TeeSink{Writer: NopCloseWriter(new(bytes.Buffer)), Policy: SinkPolicy(42)})
+		ensureError(t, err, "unknown policy")
+	})
+
+	t.Run("writes to every sink", func(t *testing.T) {
+		a := new(bytes.Buffer)
+		b := new(bytes.Buffer)
+		tee, err := NewTee(TeeSink{Writer: NopCloseWriter(a)}, TeeSink{Writer: NopCloseWriter(b), Policy: SinkBestEffort})
+		ensureError(t, err)
+		wc, err := NewWriteCloser(tee, 8)
+		ensureError(t, err)
+
+		ensureWrite(t, wc, "line 1\nline 2\npartial")
+		ensureBuffer(t, a, "line 1\nline 2\n")
+		ensureBuffer(t, b, "line 1\nline 2\n")
+		ensureError(t, wc.Close())
+		ensureBuffer(t, a, "line 1\nline 2\npartial")
+		ensureBuffer(t, b, "line 1\nline 2\npartial")
+	})
+
+	t.Run("required sink error", func(t *testing.T) {
+		a := new(bytes.Buffer)
+		var errs []error
+		tee, err := NewTee(
+			TeeSink{Writer: &errOnWrite{}, OnError: func(err error) { errs = append(errs, err) }},
+			TeeSink{Writer: NopCloseWriter(a)},
+		)
+		ensureError(t, err)
+
+		n, err := tee.Write([]byte("line 1\n"))
+		ensureError(t, err, "sink 0: test write error")
+		if got, want := n, 7; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+		ensureBuffer(t, a, "line 1\n")
+		if got, want := len(errs), 1; got != want {
+			t.Errorf("GOT: %v; WANT: %v", got, want)
+		}
+	})
+
+	t.Run("best effort sink error", func(t *testing.T) {
+		a := new(bytes.Buffer)
+		tee, err := NewTee(TeeSink{Writer: &errOnWrite{}, Policy: SinkBestEffort}, TeeSink{Writer: NopCloseWriter(a)})
+		ensureError(t, err)
+
+		_, err = tee.Write([]byte("line 1\n"))
+		ensureError(t, err)
+		ensureBuffer(t, a, "line 1\n")
+	})
+
+	t.Run("disable after failures", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		fw := &failAfterWriter{Writer: output, err: errors.New("test write error")}
+		tee, err := NewTee(TeeSink{Writer: fw, Policy: SinkDisableAfterFailures, MaxFailures: 2})
+		ensureError(t, err)
+
+		_, err = tee.Write([]byte("line 1\n"))
+		ensureError(t, err)
+
+		// Success resets consecutive failures.
+		fw.max = 7
+		_, err = tee.Write([]byte("line 2\n"))
+		ensureError(t, err)
+
+		_, err = tee.Write([]byte("line 3\n"))
+		ensureError(t, err)
+		_, err = tee.Write([]byte("line 4\n"))
+		ensureError(t, err, "sink 0 disabled after 2 consecutive failures: test write error")
+		if !tee.Disabled(0) {
+			t.Errorf("GOT: %v; WANT: %v", false, true)
+		}
+
+		fw.max = 1024
+		_, err = tee.Write([]byte("line 5\n"))
+		ensureError(t, err)
+		ensureBuffer(t, output, "line 2\n")
+	})
+
+	t.Run("close joins errors", func(t *testing.T) {
+		a := new(bytes.Buffer)
+		tee, err := NewTee(
+			TeeSink{Writer: &errOnClose{}},
+			TeeSink{Writer: NopCloseWriter(a)},
+			TeeSink{Writer: &errOnClose{}},
+		)
+		ensureError(t, err)
+
+		err = tee.Close()
+		ensureError(t, err, "sink 0: test close error\nsink 2: test close error")
+		ensureError(t, tee.Close(), "closed")
+	})
+}
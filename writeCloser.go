@@ -4,21 +4,55 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 )
 
 // WriteCloser is an io.WriteCloser that buffers output to ensure it only emits
-// bytes to the underlying io.WriteCloser on line feed boundaries.
+// bytes to the underlying io.WriteCloser on line feed boundaries. Its methods
+// are safe to invoke from multiple goroutines. While lines are terminated by LF
+// by default, WithDelimiter configures a different record delimiter, in which
+// case the LF mentioned in the documentation of its methods refers to that
+// delimiter.
 type WriteCloser struct {
+	lock                sync.Mutex
 	buf                 []byte // where we store accumulated bytes waiting for newline
 	iowc                io.WriteCloser
-	flushThreshold      int // flush on LF after buffer this size or larger
-	indexOfFinalNewline int // -1 when no newlines in buf
+	flushThreshold      int  // flush on LF after buffer this size or larger
+	indexOfFinalNewline int  // index of final byte of final delimiter; -1 when no delimiters in buf
+	lineAtomic          bool // when true, every Write is terminated with delimiter
+	delimiter           []byte
+
+	maxLineLength      int // when positive, maximum length of line excluding delimiter
+	longLinePolicy     LongLinePolicy
+	continuationMarker []byte
+	truncated          int    // number of bytes discarded from final partial line
+	scratch            []byte // reused when rewriting long lines
+
+	clock         Clock
+	flushInterval time.Duration // when positive, maximum time completed lines remain in buf
+	flushTimer    Timer         // non-nil while completed lines wait for flushInterval
+
+	asyncQueueSize int // when positive, iowc is an asyncWriter with this queue size
+	asyncPolicy    QueueFullPolicy
+	drainTimeout   time.Duration
+	async          *asyncWriter // non-nil when asyncQueueSize is positive
+
+	stats               Stats
+	latency             LatencyHistogram
+	slowFlushThreshold  time.Duration
+	slowFlushCallback   func(time.Duration, int, error)
+	retry               *RetryPolicy // non-nil when failed writes are retried
+	completeShortWrites bool
+	strictFlushes       bool   // when true, failed flush retains all unwritten bytes
+	spool               *spool // non-nil when failed writes are spooled to disk
 }
 
 // NewWriteCloser returns new WriteCloser with the specified flush
 // threshold. Whenever the buffer is greater than the specified threshold, it
 // flushes the buffer, up to and including the final LF byte, to the underlying
-// io.WriteCloser.
+// io.WriteCloser. Zero or more Option values may be provided to further
+// configure the returned WriteCloser.
 //
 //     func Example() error {
 //         // Flush completed lines to os.Stdout at least every 512 bytes.
@@ -37,15 +71,38 @@ type WriteCloser struct {
 //         }
 //         return rerr
 //     }
-func NewWriteCloser(iowc io.WriteCloser, flushThreshold int) (*WriteCloser, error) {
+func NewWriteCloser(iowc io.WriteCloser, flushThreshold int, options ...Option) (*WriteCloser, error) {
 	if flushThreshold <= 0 {
 		return nil, fmt.Errorf("cannot create WriteCloser when flushThreshold less than or equal to 0: %d", flushThreshold)
 	}
-	return &WriteCloser{
+	lbf := &WriteCloser{
 		iowc:                iowc,
 		flushThreshold:      flushThreshold,
 		indexOfFinalNewline: -1,
-	}, nil
+		clock:               systemClock{},
+		delimiter:           []byte{'\n'},
+		continuationMarker:  []byte(DefaultContinuationMarker),
+	}
+	for _, option := range options {
+		if err := option(lbf); err != nil {
+			return nil, err
+		}
+	}
+	if lbf.spool != nil {
+		// Terminate a partial line left by a process that did not close
+		// its WriteCloser.
+		if _, err := lbf.spool.terminate(lbf.delimiter); err != nil {
+			return nil, err
+		}
+		if err := lbf.spool.closeSegment(); err != nil {
+			return nil, err
+		}
+	}
+	if lbf.asyncQueueSize > 0 {
+		lbf.async = newAsyncWriter(iowc, lbf.asyncQueueSize, lbf.asyncPolicy, lbf.drainTimeout, lbf.clock, lbf.delimiter)
+		lbf.iowc = lbf.async
+	}
+	return lbf, nil
 }
 
 // Close writes all data in its buffer to the underlying io.WriteCloser,
@@ -54,10 +111,41 @@ func NewWriteCloser(iowc io.WriteCloser, flushThreshold int) (*WriteCloser, erro
 // to the underlying io.WriteCloser, or an error caused by closing it. Use this
 // method when done with a WriteCloser to prevent data loss.
 func (lbf *WriteCloser) Close() error {
-	_, we := lbf.iowc.Write(lbf.buf)
+	lbf.lock.Lock()
+	defer lbf.lock.Unlock()
+
+	if lbf.flushTimer != nil {
+		lbf.flushTimer.Stop()
+		lbf.flushTimer = nil
+	}
+
+	lbf.terminateTruncated()
+	if len(lbf.buf) > 0 && !bytes.HasSuffix(lbf.buf, lbf.delimiter) {
+		lbf.stats.PartialLinesAtClose++
+	}
+	nw, we := lbf.writeSpooled(lbf.buf)
+	if we == nil && nw < len(lbf.buf) && lbf.strictFlushes {
+		we = io.ErrShortWrite
+	}
+	if we != nil && lbf.strictFlushes {
+		we = lbf.flushError(nw, we)
+	}
 	lbf.buf = nil
 	lbf.indexOfFinalNewline = -1
 	ce := lbf.iowc.Close()
+	if ce != nil {
+		lbf.stats.SinkErrors++
+	}
+	if lbf.spool != nil {
+		ns, se := lbf.spool.terminate(lbf.delimiter)
+		lbf.stats.Spooled += uint64(ns)
+		if cse := lbf.spool.closeSegment(); se == nil {
+			se = cse
+		}
+		if ce == nil {
+			ce = se
+		}
+	}
 	lbf.iowc = nil
 	if we == nil {
 		return ce
@@ -65,17 +153,53 @@ func (lbf *WriteCloser) Close() error {
 	return we
 }
 
+// Flush writes all completed lines in its buffer, up to and including the
+// final LF, to the underlying io.WriteCloser, regardless of the flush
+// threshold. Bytes after the final LF remain in the buffer. Unlike Close, the
+// underlying io.WriteCloser remains open. When the write fails, the unwritten
+// bytes remain in the buffer. When configured by WithSpool, Flush also replays
+// the spool, even when the buffer has no completed lines.
+func (lbf *WriteCloser) Flush() error {
+	lbf.lock.Lock()
+	defer lbf.lock.Unlock()
+	return lbf.flushLines()
+}
+
+// FlushAll writes all data in its buffer to the underlying io.WriteCloser,
+// including bytes without a trailing LF. Unlike Close, the underlying
+// io.WriteCloser remains open. When the write fails, the unwritten bytes
+// remain in the buffer.
+func (lbf *WriteCloser) FlushAll() error {
+	lbf.lock.Lock()
+	defer lbf.lock.Unlock()
+	lbf.terminateTruncated()
+	if len(lbf.buf) == 0 {
+		return nil
+	}
+	_, err := lbf.flush(len(lbf.buf), 0, len(lbf.buf))
+	return err
+}
+
 // flush flushes buffer to underlying io.WriteCloser, up to and including
 // specified index.
 func (lbf *WriteCloser) flush(olen, dlen, index int) (int, error) {
-	nw, err := lbf.iowc.Write(lbf.buf[:index])
+	nw, err := lbf.writeSpooled(lbf.buf[:index])
+	if err == nil && nw < index && lbf.strictFlushes {
+		err = io.ErrShortWrite
+	}
+	if err != nil && lbf.strictFlushes {
+		err = lbf.flushError(nw, err)
+	}
 	if nw > 0 {
 		nc := copy(lbf.buf, lbf.buf[nw:])
 		lbf.buf = lbf.buf[:nc]
 	}
-	if err == nil {
-		lbf.indexOfFinalNewline -= nw
-		return dlen, nil
+	if err == nil || lbf.strictFlushes {
+		// Unwritten bytes, including those from p, remain in the buffer.
+		if lbf.indexOfFinalNewline -= nw; lbf.indexOfFinalNewline < 0 {
+			lbf.indexOfFinalNewline = -1 // also wrote bytes after final LF
+		}
+		return dlen, err
 	}
 	// nb is the number new bytes from p that got written to file.
 	nb := nw - olen
@@ -84,27 +208,129 @@ func (lbf *WriteCloser) flush(olen, dlen, index int) (int, error) {
 		nb = 0
 	} else {
 		lbf.buf = lbf.buf[:0]
+		if nb > dlen {
+			nb = dlen // delimiter appended by WithLineAtomicWrites was written
+		}
 	}
-	lbf.indexOfFinalNewline = bytes.LastIndexByte(lbf.buf, '\n')
+	lbf.indexOfFinalNewline = -1
+	lbf.indexOfFinalNewline = lbf.lastDelimiter(0)
 	return nb, err
 }
 
+// terminateTruncated appends the truncation suffix to the final partial line
+// when bytes have been discarded from it, prior to writing it without a
+// delimiter.
+func (lbf *WriteCloser) terminateTruncated() {
+	if lbf.truncated > 0 {
+		lbf.buf = appendTruncationSuffix(lbf.buf, lbf.truncated)
+		lbf.truncated = 0
+	}
+}
+
+// lastDelimiter returns the index of the final byte of the final delimiter in
+// buffer that ends at or after index from, or -1 when there is none. A
+// multiple byte delimiter that begins before from, but after the previously
+// found delimiter, is found even when it was split across multiple writes.
+func (lbf *WriteCloser) lastDelimiter(from int) int {
+	if len(lbf.delimiter) == 1 {
+		if i := bytes.LastIndexByte(lbf.buf[from:], lbf.delimiter[0]); i >= 0 {
+			return from + i
+		}
+		return -1
+	}
+	start := from - len(lbf.delimiter) + 1
+	if start <= lbf.indexOfFinalNewline {
+		start = lbf.indexOfFinalNewline + 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	return lastDelimiter(lbf.buf, lbf.delimiter, start)
+}
+
+// lastDelimiter returns the index of the final byte of the final delimiter in
+// buf that begins at or after index start, or -1 when there is none.
+func lastDelimiter(buf, delimiter []byte, start int) int {
+	if i := bytes.LastIndex(buf[start:], delimiter); i >= 0 {
+		return start + i + len(delimiter) - 1
+	}
+	return -1
+}
+
+// flushLines flushes all completed lines in buffer to the underlying
+// io.WriteCloser, leaving the final partial line in the buffer.
+func (lbf *WriteCloser) flushLines() error {
+	if lbf.indexOfFinalNewline < 0 {
+		if lbf.spool != nil {
+			return lbf.spool.replay(lbf.writeSink)
+		}
+		return nil // buffer has no completed lines
+	}
+	_, err := lbf.flush(len(lbf.buf), 0, lbf.indexOfFinalNewline+1)
+	return err
+}
+
+// armFlushTimer starts the flush timer when a flush interval is configured,
+// the buffer has completed lines, and the timer is not already running.
+func (lbf *WriteCloser) armFlushTimer() {
+	if lbf.flushInterval > 0 && lbf.flushTimer == nil && lbf.indexOfFinalNewline >= 0 {
+		lbf.flushTimer = lbf.clock.AfterFunc(lbf.flushInterval, lbf.onFlushTimer)
+	}
+}
+
+// onFlushTimer is invoked when the flush interval elapses, and flushes all
+// completed lines. When the flush fails, the unwritten lines remain in the
+// buffer and the timer is started again so they will be retried.
+func (lbf *WriteCloser) onFlushTimer() {
+	lbf.lock.Lock()
+	defer lbf.lock.Unlock()
+
+	lbf.flushTimer = nil
+	if lbf.iowc == nil {
+		return // closed
+	}
+	_ = lbf.flushLines()
+	lbf.armFlushTimer()
+}
+
 // Write appends bytes from p to internal buffer, flushing buffer up to and
 // including the final LF when buffer length exceeds programmed threshold.
 func (lbf *WriteCloser) Write(p []byte) (int, error) {
+	lbf.lock.Lock()
+	n, err := lbf.write(p)
+	lbf.stats.BytesIn += uint64(n)
+	lbf.lock.Unlock()
+	return n, err
+}
+
+func (lbf *WriteCloser) write(p []byte) (int, error) {
 	olen := len(lbf.buf)
 	lbf.buf = append(lbf.buf, p...)
+	if len(lbf.buf) > lbf.stats.PeakBuffered {
+		lbf.stats.PeakBuffered = len(lbf.buf)
+	}
+
+	if lbf.lineAtomic && len(p) > 0 && !bytes.HasSuffix(p, lbf.delimiter) {
+		lbf.buf = append(lbf.buf, lbf.delimiter...)
+	}
+
+	if lbf.maxLineLength > 0 {
+		return lbf.writeLimited(olen, len(p))
+	}
 
-	if finalIndex := bytes.LastIndexByte(p, '\n'); finalIndex >= 0 {
-		lbf.indexOfFinalNewline = olen + finalIndex
+	if finalIndex := lbf.lastDelimiter(olen); finalIndex >= 0 {
+		lbf.indexOfFinalNewline = finalIndex
 	}
 
 	if len(lbf.buf) <= lbf.flushThreshold || lbf.indexOfFinalNewline < 0 {
 		// Either do not need to flush, or no newline in buffer
+		lbf.armFlushTimer()
 		return len(p), nil
 	}
 
 	// Buffer larger than threshold, and has LF: write everything up to and
 	// including that final LF.
-	return lbf.flush(olen, len(p), lbf.indexOfFinalNewline+1)
+	n, err := lbf.flush(olen, len(p), lbf.indexOfFinalNewline+1)
+	lbf.armFlushTimer()
+	return n, err
 }